@@ -2,6 +2,9 @@ package main
 
 import (
 	"dns"
+	"fmt"
+	"os"
+	"rules"
 )
 
 func match(m *dns.Msg, d int) (*dns.Msg, bool) {
@@ -25,19 +28,25 @@ func match(m *dns.Msg, d int) (*dns.Msg, bool) {
 	return m, true
 }
 
+// send hands m to the upstream pool (see pool.go): depending on
+// -strategy this is round-robin, weighted-random or a first-response
+// race across every healthy server, with per-upstream retry/backoff
+// already applied.
 func send(m *dns.Msg, ok bool) (o *dns.Msg) {
-	switch ok {
-	case true, false:
-                for _, r := range qr {
-                        in <- Query{Msg: m, Conn: r}
-                }
-                return
-	}
-	return
+	return exchangeUpstream(m)
 }
 
 // Return the configration
 func funkensturm() *Funkensturm {
+	if rulesFile != nil && *rulesFile != "" {
+		f, err := funkensturmFromRules(*rulesFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "rules: %s\n", err.String())
+		} else {
+			return f
+		}
+	}
+
 	f := new(Funkensturm)
 
         // Nothing to set up
@@ -53,3 +62,45 @@ func funkensturm() *Funkensturm {
 	f.Actions[0].Func = send
 	return f
 }
+
+// funkensturmFromRules loads path with the rules package and flattens
+// its []*rules.Rule into the []Match / []Action shape Funkensturm
+// expects: each rule becomes one AND-ed Match (so all rules run, each
+// gating only its own actions) whose actions are wrapped so they only
+// fire for the packets that rule actually matched.
+func funkensturmFromRules(path string) (*Funkensturm, os.Error) {
+	rules.SetForwarder(func(m *dns.Msg, addr string) {
+		send(m, true)
+	})
+	parsed, err := rules.Load(path)
+	if err != nil {
+		return nil, err
+	}
+	f := new(Funkensturm)
+	f.Setup = func() bool { return true }
+	f.Matches = make([]Match, len(parsed))
+	f.Actions = make([]Action, len(parsed))
+	for i, r := range parsed {
+		r := r
+		f.Matches[i] = Match{Op: AND, Func: func(m *dns.Msg, dir int) (*dns.Msg, bool) {
+			return r.Cond(m, dir)
+		}}
+		f.Actions[i] = Action{Func: func(m *dns.Msg, ok bool) *dns.Msg {
+			// ok is the aggregate result across every rule, not
+			// this one: re-evaluate this rule's own condition so
+			// its actions only fire when it actually matched.
+			_, matched := r.Cond(m, IN)
+			if !matched {
+				return m
+			}
+			for _, a := range r.Actions {
+				m = a(m, true)
+				if m == nil {
+					return nil
+				}
+			}
+			return m
+		}}
+	}
+	return f, nil
+}
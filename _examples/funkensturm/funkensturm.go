@@ -13,8 +13,14 @@ import (
 	"dns"
 	"os/signal"
 	"strings"
+	"qlog"
 )
 
+// Path to a rule-language file (see the rules package); when set,
+// funkensturm() builds Matches/Actions from it instead of the
+// compiled-in match()/send() pair in config.go.
+var rulesFile *string
+
 // Define a slice of conn for sending queries
 var qr []*dns.Conn
 var in chan dns.Query
@@ -71,10 +77,13 @@ type Funkensturm struct {
 	Actions []Action    // What to do with the packets
 }
 
+// verboseprint is now just "text backend at debug level": every
+// stage dump becomes a qlog.Record instead of an ad-hoc Printf, so
+// -qlog json/-qlog dnstap:... see the same stages -verbose does.
 func verboseprint(i *dns.Msg, msg string) {
-	fmt.Printf(">>>>>> %s\n", msg)
-	fmt.Printf("%v", i)
-	fmt.Printf("<<<<<< %s\n\n", msg)
+	r := qlog.NewRecord("", "debug", i, nil)
+	r.Trace = []string{msg}
+	qlog.Log(r)
 }
 
 func doFunkensturm(pkt *dns.Msg) ([]byte, os.Error) {
@@ -86,6 +95,11 @@ func doFunkensturm(pkt *dns.Msg) ([]byte, os.Error) {
 		return nil, &dns.Error{Error: "Response bit set, not replying"}
 	}
 
+	tsigKeyname, tsigMAC, tsigOk := verifyInbound(pkt)
+	if !tsigOk {
+		return nil, &dns.Error{Error: "TSIG did not verify"}
+	}
+
 	// Loop through the Match* functions and decide what to do
 	// Note the packet can be changed by these function, this 
 	// change is cumulative.
@@ -130,6 +144,8 @@ func doFunkensturm(pkt *dns.Msg) ([]byte, os.Error) {
 		return nil, nil
 	}
 
+	signOutbound(pkt1, tsigKeyname, tsigMAC)
+
 	if *verbose {
 		verboseprint(pkt1, "MODIFIED OUTGOING")
 		fmt.Printf("-----------------------------------\n\n")
@@ -169,6 +185,9 @@ func udp(addr string, e chan os.Error) {
 func main() {
 	var sserver *string = flag.String("sserver", "127.0.0.1:8053", "Set the listener address")
 	var rserver *string = flag.String("rserver", "127.0.0.1:53", "Remote server address(es), seperate with commas")
+	var strategy *string = flag.String("strategy", "roundrobin", "Upstream selection: roundrobin, weighted, first-response")
+	rulesFile = flag.String("rules", "", "Load Matches/Actions from this rule file instead of config.go")
+	qlogSpec := flag.String("qlog", "", "Query log backend: text, json, dnstap:/path/to.sock (defaults to text when -verbose)")
 	verbose = flag.Bool("verbose", false, "Print packet as it flows through") // verbose needs to be global
 	flag.Usage = func() {
 		fmt.Fprintf(os.Stderr, "Usage: %s\n", os.Args[0])
@@ -176,13 +195,38 @@ func main() {
 	}
 	flag.Parse()
 
+	spec := *qlogSpec
+	if spec == "" && *verbose {
+		spec = "text"
+	}
+	loadTsigKeys(*tsigKeyFlag)
+
+	if spec != "" {
+		backend, err := qlog.Open(spec)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "qlog: %s\n", err.String())
+		} else {
+			qlog.SetBackend(backend)
+		}
+	}
+
 	resolvers := strings.Split(*rserver, ",", -1)
-	qr = make([]*dns.Resolver, len(resolvers))
+	qr = make([]*dns.Conn, len(resolvers))
 	for i, ra := range resolvers {
 		d := new(dns.Conn)
-		d.RemoteAddr = addr
+		d.RemoteAddr = ra
 		qr[i] = d
 	}
+	initPool(resolvers, qr)
+	loadRetryConfig("/etc/resolv.conf")
+
+	strategyFlag, ok1 := strategyNames[*strategy]
+	if !ok1 {
+		fmt.Fprintf(os.Stderr, "Unknown -strategy %s, using roundrobin\n", *strategy)
+		strategyFlag = RoundRobin
+	}
+	upstreamStrategy = strategyFlag
+	startHealthChecker()
 
 	f = funkensturm()
 	ok := f.Setup()
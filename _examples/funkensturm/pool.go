@@ -0,0 +1,279 @@
+package main
+
+// An upstream pool for Funkensturm: round-robin, weighted-random and
+// first-response selection across the qr []*dns.Conn slice, with a
+// background health prober that marks a server dead on failure and
+// retries it with exponential backoff.
+
+import (
+	"dns"
+	"rand"
+	"resolver"
+	"sync"
+	"time"
+)
+
+// upstreamStrategy is the selection strategy in effect, set from
+// -strategy in main().
+var upstreamStrategy = RoundRobin
+
+// retryConfig mirrors the Attempts/Timeout resolver.FromFile already
+// parses out of /etc/resolv.conf, so Funkensturm's own retries follow
+// the same knobs a stub resolver would.
+var retryConfig = &resolver.Resolver{Attempts: 2, Timeout: 5}
+
+// loadRetryConfig overlays retryConfig with whatever resolv.conf (or
+// equivalent) says, falling back to the defaults above if it can't
+// be read.
+func loadRetryConfig(conf string) {
+	r := new(resolver.Resolver)
+	if err := r.FromFile(conf); err == nil {
+		retryConfig = r
+	}
+}
+
+// Selection strategies, chosen with -strategy.
+const (
+	RoundRobin = iota
+	WeightedRandom
+	FirstResponse
+)
+
+// strategyNames lets -strategy take a human string.
+var strategyNames = map[string]int{
+	"roundrobin":     RoundRobin,
+	"weighted":       WeightedRandom,
+	"first-response": FirstResponse,
+}
+
+// upstream tracks one resolver's health and counters, on top of the
+// *dns.Conn funkensturm.go already opens for it.
+type upstream struct {
+	addr   string
+	conn   *dns.Conn
+	weight int // higher weight == picked more often by WeightedRandom
+
+	dead      bool
+	backoff   int64 // seconds, doubles on every failed probe
+	nextProbe int64 // time.Seconds() of the next allowed probe
+
+	queries uint64
+	errors  uint64
+	rtts    []int64 // last few round-trip times, in ms, for a crude histogram
+}
+
+const maxRttSamples = 64
+const minBackoff = 1
+const maxBackoff = 300
+
+// pool is every upstream funkensturm was configured with, in the
+// order given on -rserver; rr is the round-robin cursor.
+var pool []*upstream
+var poolMu sync.Mutex
+var rr int
+
+// initPool builds the upstream pool from the addresses already used
+// to fill in the qr slice in main().
+func initPool(addrs []string, conns []*dns.Conn) {
+	pool = make([]*upstream, len(addrs))
+	for i, a := range addrs {
+		pool[i] = &upstream{addr: a, conn: conns[i], weight: 1}
+	}
+}
+
+// healthy returns the upstreams currently believed to be up.
+func healthy() []*upstream {
+	poolMu.Lock()
+	defer poolMu.Unlock()
+	up := make([]*upstream, 0, len(pool))
+	for _, u := range pool {
+		if !u.dead {
+			up = append(up, u)
+		}
+	}
+	return up
+}
+
+// pick selects the next upstream(s) to use according to strategy.
+// FirstResponse returns every healthy upstream (the caller races
+// them); the other strategies return exactly one.
+func pick(strategy int) []*upstream {
+	up := healthy()
+	if len(up) == 0 {
+		// Nothing is healthy; fall back to the whole pool rather
+		// than dropping the query on the floor.
+		return pool
+	}
+	switch strategy {
+	case FirstResponse:
+		return up
+	case WeightedRandom:
+		total := 0
+		for _, u := range up {
+			total += u.weight
+		}
+		if total <= 0 {
+			// Every healthy upstream has weight 0: rand.Intn would
+			// panic, so just fall back to the first one.
+			return []*upstream{up[0]}
+		}
+		n := rand.Intn(total)
+		for _, u := range up {
+			if n < u.weight {
+				return []*upstream{u}
+			}
+			n -= u.weight
+		}
+		return []*upstream{up[0]}
+	default: // RoundRobin
+		poolMu.Lock()
+		// Walk the cursor against the full pool, not the
+		// health-filtered slice, so it doesn't skip or repeat
+		// servers as the healthy set changes size.
+		var u *upstream
+		for i := 0; i < len(pool); i++ {
+			idx := (rr + i) % len(pool)
+			if !pool[idx].dead {
+				u = pool[idx]
+				rr = (idx + 1) % len(pool)
+				break
+			}
+		}
+		poolMu.Unlock()
+		if u == nil {
+			u = up[0]
+		}
+		return []*upstream{u}
+	}
+}
+
+// markResult updates an upstream's counters after a query attempt;
+// rttMs is ignored on failure.
+func markResult(u *upstream, ok bool, rttMs int64) {
+	poolMu.Lock()
+	defer poolMu.Unlock()
+	u.queries++
+	if !ok {
+		u.errors++
+		markDead(u)
+		return
+	}
+	u.rtts = append(u.rtts, rttMs)
+	if len(u.rtts) > maxRttSamples {
+		u.rtts = u.rtts[1:]
+	}
+	if u.dead {
+		u.dead = false
+		u.backoff = 0
+	}
+}
+
+// markDead flags u as down and schedules its next reprobe with
+// exponential backoff, capped at maxBackoff.
+func markDead(u *upstream) {
+	u.dead = true
+	if u.backoff == 0 {
+		u.backoff = minBackoff
+	} else {
+		u.backoff *= 2
+		if u.backoff > maxBackoff {
+			u.backoff = maxBackoff
+		}
+	}
+	u.nextProbe = time.Seconds() + u.backoff
+}
+
+// healthCheck sends a cheap "id.server." CH TXT probe to every dead
+// upstream whose backoff has elapsed, and to every live upstream
+// periodically, bringing servers back into rotation once they answer
+// again. It's meant to be run in its own goroutine, once every
+// healthCheckInterval (see startHealthChecker).
+func healthCheck() {
+	now := time.Seconds()
+	for _, u := range pool {
+		poolMu.Lock()
+		due := !u.dead || now >= u.nextProbe
+		poolMu.Unlock()
+		if !due {
+			continue
+		}
+		probe(u)
+	}
+}
+
+// probe sends the id.server. CH TXT query and records whether the
+// upstream answered at all (the content of the reply doesn't matter,
+// only that it came back).
+func probe(u *upstream) {
+	q := new(dns.Msg)
+	q.SetQuestionType("id.server.", dns.TypeTXT, dns.ClassCHAOS)
+	start := time.Nanoseconds()
+	_, err := u.conn.Exchange(q)
+	rttMs := (time.Nanoseconds() - start) / 1e6
+	markResult(u, err == nil, rttMs)
+}
+
+const healthCheckInterval = 10 * 1e9 // ns, i.e. 10s
+
+// startHealthChecker launches the periodic prober; call once from main.
+func startHealthChecker() {
+	go func() {
+		for {
+			time.Sleep(healthCheckInterval)
+			healthCheck()
+		}
+	}()
+}
+
+// exchangeUpstream sends m to the pool according to upstreamStrategy,
+// retrying on the next healthy peer up to retryConfig.Attempts times,
+// each try waiting retryConfig.Timeout seconds, mirroring the Attempts/Timeout
+// semantics resolver.FromFile parses from resolv.conf. On
+// FirstResponse it instead fires m at every healthy upstream at once
+// and returns whichever answers first.
+func exchangeUpstream(m *dns.Msg) *dns.Msg {
+	if upstreamStrategy == FirstResponse {
+		return exchangeFirstResponse(m)
+	}
+	for attempt := 0; attempt < retryConfig.Attempts; attempt++ {
+		for _, u := range pick(upstreamStrategy) {
+			start := time.Nanoseconds()
+			u.conn.Timeout = retryConfig.Timeout
+			reply, err := u.conn.Exchange(m)
+			rttMs := (time.Nanoseconds() - start) / 1e6
+			markResult(u, err == nil, rttMs)
+			if err == nil {
+				return reply
+			}
+		}
+	}
+	return nil
+}
+
+// exchangeFirstResponse races m against every healthy upstream and
+// returns the first reply to come back, if any.
+func exchangeFirstResponse(m *dns.Msg) *dns.Msg {
+	up := pick(FirstResponse)
+	replies := make(chan *dns.Msg, len(up))
+	for _, u := range up {
+		u := u
+		go func() {
+			start := time.Nanoseconds()
+			u.conn.Timeout = retryConfig.Timeout
+			reply, err := u.conn.Exchange(m)
+			rttMs := (time.Nanoseconds() - start) / 1e6
+			markResult(u, err == nil, rttMs)
+			if err == nil {
+				replies <- reply
+			} else {
+				replies <- nil
+			}
+		}()
+	}
+	for i := 0; i < len(up); i++ {
+		if reply := <-replies; reply != nil {
+			return reply
+		}
+	}
+	return nil
+}
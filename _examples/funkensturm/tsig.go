@@ -0,0 +1,58 @@
+package main
+
+// Wires the tsig package into Funkensturm: an inbound TSIG is
+// verified (if present) and, when it verifies, the reply is signed
+// back with the same key and the request's MAC per RFC 8945.
+
+import (
+	"dns"
+	"flag"
+	"strings"
+	"tsig"
+)
+
+var tsigKeyFlag *string = flag.String("tsig-key", "", "TSIG key(s) as name:algo:secret, comma separated")
+
+var tsigProvider = tsig.StaticProvider{}
+var tsigVerifier = tsig.NewVerifier(tsigProvider)
+
+func loadTsigKeys(spec string) {
+	if spec == "" {
+		return
+	}
+	for _, entry := range strings.Split(spec, ",", -1) {
+		parts := strings.Split(entry, ":", -1)
+		if len(parts) != 3 {
+			continue
+		}
+		tsigProvider[parts[0]] = tsig.StaticKey{Algo: parts[1], Secret: parts[2]}
+	}
+}
+
+// verifyInbound checks pkt's TSIG, if any, and returns the key name
+// and request MAC needed to sign the matching reply. ok is false
+// only when a TSIG was present but did not verify; an unsigned
+// request is passed through with ok == true and keyname == "".
+func verifyInbound(pkt *dns.Msg) (keyname, requestMAC string, ok bool) {
+	if len(pkt.Extra) == 0 {
+		return "", "", true
+	}
+	rr, isTsig := pkt.Extra[len(pkt.Extra)-1].(*dns.RR_TSIG)
+	if !isTsig {
+		return "", "", true
+	}
+	status, mac := tsigVerifier.Verify(pkt)
+	if status != tsig.NoError {
+		return rr.Hdr.Name, mac, false
+	}
+	return rr.Hdr.Name, mac, true
+}
+
+// signOutbound signs reply with keyname/requestMAC, if keyname is
+// set; it is a no-op for unsigned exchanges.
+func signOutbound(reply *dns.Msg, keyname, requestMAC string) {
+	if keyname == "" {
+		return
+	}
+	tsigVerifier.Sign(reply, keyname, requestMAC)
+}
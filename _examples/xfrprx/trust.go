@@ -0,0 +1,139 @@
+package main
+
+// Trust anchor handling for xfrprx: loading the apex DNSKEY(s) we
+// currently trust from disk, and the RFC 5011 add/hold-down state
+// machine that lets a new DNSKEY slowly earn trust instead of being
+// accepted on sight.
+
+import (
+	"dns"
+	"fmt"
+	"os"
+	"time"
+	"zone"
+)
+
+// HoldDownSeconds is the RFC 5011 default hold-down interval, in
+// seconds: a new key must be seen, valid, in every transfer for this
+// long before it is promoted into the trust anchor file.
+const HoldDownSeconds = 30 * 24 * 3600
+
+// anchor is a single trusted apex DNSKEY, plus the RFC 5011 timers
+// we track for it while it is still on probation.
+type anchor struct {
+	key      *dns.RR_DNSKEY
+	tag      uint16
+	trusted  bool  // already written to the trust anchor file
+	seenAt   int64 // time.Seconds() when first seen
+	lastSeen int64 // time.Seconds() of the last transfer it was valid in
+}
+
+// TrustAnchors is the set of apex keys xfrprx currently trusts or is
+// watching, keyed by keytag.
+var TrustAnchors = map[uint16]*anchor{}
+
+// trustFile is the on-disk location the trust anchors are persisted
+// to; it is overwritten whenever a pending key is promoted.
+var trustFile string
+
+// loadTrustAnchors reads a zone-file-style dump of DNSKEY RRs from
+// path, via the zone package, and seeds TrustAnchors with them, all
+// marked already-trusted.
+func loadTrustAnchors(path string) os.Error {
+	trustFile = path
+	f, err := os.Open(path, os.O_RDONLY, 0)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	for entry := range zone.ParseZone(f, ".", 0) {
+		if entry.Err != nil {
+			fmt.Printf("trust anchor file: %v\n", entry.Err)
+			continue
+		}
+		key, ok := entry.RR.(*dns.RR_DNSKEY)
+		if !ok {
+			continue
+		}
+		tag := key.KeyTag()
+		TrustAnchors[tag] = &anchor{key: key, tag: tag, trusted: true}
+	}
+	return nil
+}
+
+// saveTrustAnchors rewrites the trust anchor file with every key
+// currently marked trusted, through zone.PrintRR so the file stays
+// readable by loadTrustAnchors (or any other zone.ParseZone reader).
+// Keys still on probation are not written, so a crash during
+// hold-down simply restarts the clock.
+func saveTrustAnchors() os.Error {
+	f, err := os.Open(trustFile, os.O_WRONLY|os.O_CREAT|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	for _, a := range TrustAnchors {
+		if !a.trusted {
+			continue
+		}
+		fmt.Fprintf(f, "%s\n", zone.PrintRR(a.key))
+	}
+	return nil
+}
+
+// updateRollover applies RFC 5011 to the apex DNSKEY set just seen
+// in a (validated) zone transfer. keys is every DNSKEY at the apex;
+// signedBy is the set of keytags that signed the apex DNSKEY RRset
+// with an already-trusted key, i.e. keys we are allowed to consider
+// for add/hold-down at all.
+func updateRollover(keys []*dns.RR_DNSKEY, signedBy map[uint16]bool) {
+	now := time.Seconds()
+	seen := map[uint16]bool{}
+	for _, key := range keys {
+		tag := key.KeyTag()
+		seen[tag] = true
+
+		// REVOKE bit: drop the key immediately, trusted or not.
+		// Setting the bit changes the keytag, so the key is also
+		// dropped under the tag it had before it was revoked.
+		if key.Flags&0x0080 != 0 {
+			unrevoked := *key
+			unrevoked.Flags &^= 0x0080
+			TrustAnchors[unrevoked.KeyTag()] = nil, false
+			TrustAnchors[tag] = nil, false
+			continue
+		}
+
+		a, known := TrustAnchors[tag]
+		if known && a.trusted {
+			a.lastSeen = now
+			continue
+		}
+		if len(signedBy) == 0 {
+			// The apex DNSKEY RRset wasn't vouched for by any
+			// key we already trust; nothing to add yet. (signedBy
+			// holds trusted keys' tags, not this new key's own -
+			// a brand new key is never in it.)
+			continue
+		}
+		if !known {
+			TrustAnchors[tag] = &anchor{key: key, tag: tag, seenAt: now, lastSeen: now}
+			continue
+		}
+		a.lastSeen = now
+		if now-a.seenAt >= HoldDownSeconds {
+			a.trusted = true
+			if err := saveTrustAnchors(); err != nil {
+				fmt.Printf("err writing trust anchors: %v\n", err)
+			}
+		}
+	}
+	// A key that has dropped out of the apex set entirely while
+	// still on probation loses its standing; start over if it
+	// ever reappears.
+	for tag, a := range TrustAnchors {
+		if a != nil && !a.trusted && !seen[tag] {
+			TrustAnchors[tag] = nil, false
+		}
+	}
+}
@@ -0,0 +1,48 @@
+package main
+
+// Wires the tsig package into xfrprx: inbound NOTIFY/AXFR/IXFR must
+// carry a TSIG that verifies against a configured key before xfrprx
+// will trust anything it transfers.
+
+import (
+	"dns"
+	"flag"
+	"strings"
+	"tsig"
+)
+
+// tsigKey is "name:algorithm:base64secret", repeatable via commas,
+// e.g. -tsig-key example.:hmac-sha256.:base64==,other.:hmac-sha256.:base64==
+var tsigKeyFlag *string = flag.String("tsig-key", "", "TSIG key(s) as name:algo:secret, comma separated")
+
+var tsigProvider = tsig.StaticProvider{}
+var tsigVerifier = tsig.NewVerifier(tsigProvider)
+
+// loadTsigKeys parses -tsig-key into tsigProvider.
+func loadTsigKeys(spec string) {
+	if spec == "" {
+		return
+	}
+	for _, entry := range strings.Split(spec, ",", -1) {
+		parts := strings.Split(entry, ":", -1)
+		if len(parts) != 3 {
+			continue
+		}
+		tsigProvider[parts[0]] = tsig.StaticKey{Algo: parts[1], Secret: parts[2]}
+	}
+}
+
+// requiresTsig reports whether i is a message xfrprx must not trust
+// without a verifying TSIG: an incoming NOTIFY, or any message whose
+// question asks for an AXFR or IXFR.
+func requiresTsig(i *dns.Msg) bool {
+	if i.MsgHdr.Opcode == dns.OpcodeNotify {
+		return true
+	}
+	for _, q := range i.Question {
+		if q.Qtype == dns.TypeAXFR || q.Qtype == dns.TypeIXFR {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,178 @@
+package main
+
+// Zone validation: once a transfer has completed we group the
+// answer into RRSets, match each signed set against its covering
+// RRSIG(s) and check the signature chains up to the apex DNSKEY
+// set loaded from the trust anchor file. NSEC/NSEC3 RRSets need a
+// valid covering RRSIG like any other RRSet; whether the NSEC/NSEC3
+// chain covers the whole zone is not checked.
+
+import (
+	"dns"
+	"fmt"
+	"strings"
+)
+
+// rrsetKey identifies an RRSet by owner name and type; records of
+// the same owner+type but different class never occur within one
+// zone so class is not part of the key.
+type rrsetKey struct {
+	name string
+	kind uint16
+}
+
+// groupRRSets buckets rrs by owner+type and returns, alongside them,
+// the RRSIGs that cover each bucket (keyed the same way, but under
+// the *covered* type, not TypeRRSIG).
+func groupRRSets(rrs []dns.RR) (map[rrsetKey][]dns.RR, map[rrsetKey][]*dns.RR_RRSIG) {
+	sets := map[rrsetKey][]dns.RR{}
+	sigs := map[rrsetKey][]*dns.RR_RRSIG{}
+	for _, rr := range rrs {
+		if sig, ok := rr.(*dns.RR_RRSIG); ok {
+			k := rrsetKey{sig.Hdr.Name, sig.TypeCovered}
+			sigs[k] = append(sigs[k], sig)
+			continue
+		}
+		k := rrsetKey{rr.Header().Name, rr.Header().Rrtype}
+		sets[k] = append(sets[k], rr)
+	}
+	return sets, sigs
+}
+
+// apexDNSKEYs pulls every DNSKEY owned by the zone apex out of rrs.
+func apexDNSKEYs(rrs []dns.RR, apex string) []*dns.RR_DNSKEY {
+	keys := make([]*dns.RR_DNSKEY, 0)
+	for _, rr := range rrs {
+		if key, ok := rr.(*dns.RR_DNSKEY); ok && key.Hdr.Name == apex {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// delegationPoints returns every owner name, other than the zone
+// apex itself, that carries an NS RRset in sets. Those names are
+// zone cuts: authority for them (and anything below them) belongs
+// to the child zone, not to this one.
+func delegationPoints(sets map[rrsetKey][]dns.RR, apex string) []string {
+	cuts := make([]string, 0)
+	for k := range sets {
+		if k.kind == dns.TypeNS && k.name != apex {
+			cuts = append(cuts, k.name)
+		}
+	}
+	return cuts
+}
+
+// belowCut reports whether name sits at or beneath one of the zone
+// cuts in cuts: the delegation NS RRset itself, or glue (A/AAAA,
+// etc.) hanging off the delegated name. Such records are unsigned by
+// design and must not be held to the same RRSIG requirement as the
+// rest of the zone.
+func belowCut(name string, apex string, cuts []string) bool {
+	for _, cut := range cuts {
+		if name == cut {
+			return true
+		}
+		if name != apex && strings.HasSuffix(name, "."+cut) {
+			return true
+		}
+	}
+	return false
+}
+
+// validateZone checks every signed RRSet in rrs against the apex
+// DNSKEY set; RRSets at or below a delegation point are skipped. It
+// returns true only if every RRSet that should be signed, NSEC/NSEC3
+// included, has at least one RRSIG that verifies with a key we trust.
+// The NSEC/NSEC3 chain itself is not checked for coverage.
+func validateZone(apex string, rrs []dns.RR) bool {
+	sets, sigs := groupRRSets(rrs)
+	keys := apexDNSKEYs(rrs, apex)
+
+	byTag := map[uint16]*dns.RR_DNSKEY{}
+	for _, k := range keys {
+		byTag[k.KeyTag()] = k
+	}
+
+	// The apex DNSKEY RRset must itself be signed by a key we
+	// already trust before we even look at the rest of the zone;
+	// this is also what feeds RFC 5011 rollover below.
+	apexKey := rrsetKey{apex, dns.TypeDNSKEY}
+	signedBy := map[uint16]bool{}
+	for _, sig := range sigs[apexKey] {
+		trusted, ok := TrustAnchors[sig.KeyTag]
+		if !ok || !trusted.trusted {
+			continue
+		}
+		if verifyRRSIG(sig, sets[apexKey], byTag[sig.KeyTag]) {
+			signedBy[sig.KeyTag] = true
+		}
+	}
+	if len(signedBy) == 0 {
+		fmt.Printf("apex DNSKEY RRset not signed by a trusted key\n")
+		return false
+	}
+
+	cuts := delegationPoints(sets, apex)
+
+	for k, set := range sets {
+		if k.kind == dns.TypeRRSIG {
+			continue
+		}
+		if belowCut(k.name, apex, cuts) {
+			// Delegation NS RRsets, and any glue beneath them,
+			// are deliberately unsigned: authority for that
+			// name belongs to the child zone, not us.
+			continue
+		}
+		if k.kind == dns.TypeNSEC || k.kind == dns.TypeNSEC3 {
+			// Non-existence proofs need a valid covering
+			// RRSIG, like a normal RRSet; their chain
+			// coverage is not checked here.
+			if !anySigValid(sigs[k], set, byTag) {
+				fmt.Printf("%s/%d: no valid NSEC(3) coverage\n", k.name, k.kind)
+				return false
+			}
+			continue
+		}
+		if !anySigValid(sigs[k], set, byTag) {
+			fmt.Printf("%s/%d: RRSet does not validate\n", k.name, k.kind)
+			return false
+		}
+	}
+
+	updateRollover(keys, signedBy)
+	return true
+}
+
+// anySigValid reports whether at least one of sigs verifies set
+// against a DNSKEY we already know about.
+func anySigValid(sigs []*dns.RR_RRSIG, set []dns.RR, byTag map[uint16]*dns.RR_DNSKEY) bool {
+	for _, sig := range sigs {
+		if verifyRRSIG(sig, set, byTag[sig.KeyTag]) {
+			return true
+		}
+	}
+	return false
+}
+
+// verifyRRSIG checks that sig, using key, covers set correctly: the
+// algorithm, signer name and expiration/inception window all line
+// up and the cryptographic signature itself verifies.
+func verifyRRSIG(sig *dns.RR_RRSIG, set []dns.RR, key *dns.RR_DNSKEY) bool {
+	if key == nil || sig == nil || len(set) == 0 {
+		return false
+	}
+	if sig.Algorithm != key.Algorithm {
+		return false
+	}
+	if sig.SignerName != key.Hdr.Name {
+		return false
+	}
+	now := dns.SerialNow()
+	if dns.SerialLess(sig.Expiration, now) || dns.SerialLess(now, sig.Inception) {
+		return false
+	}
+	return sig.Verify(key, set)
+}
@@ -14,37 +14,107 @@ package main
 import (
 	"os"
 	"os/signal"
+	"flag"
 	"fmt"
 	"dns"
+	"qlog"
+	"tsig"
+	zonefile "zone"
 )
 
-// Static amount of RRs...
+var anchorFile *string = flag.String("anchors", "trusted-keys", "Trust anchor file (apex DNSKEY RRs)")
+var qlogSpec *string = flag.String("qlog", "text", "Query log backend: text, json, dnstap:/path/to.sock")
+
+// zone holds the RRs of a transferred or statically-loaded zone,
+// through the zone package rather than a fixed-size array.
 type zone struct {
 	name string
-	rrs  [10000]dns.RR
-	size int
+	rrs  []dns.RR
         correct bool
 }
 
+// allRRs returns every RR currently held for this zone.
+func (z *zone) allRRs() []dns.RR {
+	return z.rrs
+}
+
+// loadZoneFile replaces z's contents by parsing path with the zone
+// package, e.g. for a static zone on disk instead of one learned
+// through AXFR/IXFR.
+func (z *zone) loadZoneFile(path, origin string) os.Error {
+	f, err := os.Open(path, os.O_RDONLY, 0)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	z.name = dns.Fqdn(origin)
+	z.rrs = z.rrs[0:0]
+	for entry := range zonefile.ParseZone(f, origin, 3600) {
+		if entry.Err != nil {
+			return entry.Err
+		}
+		z.rrs = append(z.rrs, entry.RR)
+	}
+	return nil
+}
+
 var Zone zone
 
 func handle(d *dns.Conn, i *dns.Msg) {
+	r := qlog.NewRecord(d.RemoteAddr, proto(d), i, nil)
+	defer qlog.Log(r)
+
 	if i.MsgHdr.Response == true {
 		return
 	}
+
+	if requiresTsig(i) {
+		if !tsig.HasTSIG(i) {
+			// Verify returns NoError for a message that simply
+			// carries no TSIG; that's fine for messages we don't
+			// require one on, but not here.
+			r.Tsig = tsig.BadKey.String()
+			r.Trace = append(r.Trace, "tsig required but absent")
+			return
+		}
+		status, _ := tsigVerifier.Verify(i)
+		r.Tsig = status.String()
+		if status != tsig.NoError {
+			r.Trace = append(r.Trace, "tsig rejected: "+status.String())
+			return
+		}
+	}
+
 	if err := handleNotify(d, i); err != nil {
-                fmt.Printf("err %v\n", err)
+                r.Trace = append(r.Trace, "notify err: "+err.String())
         }
-//        handleNotifyOut("127.0.0.1:53") // 
+//        handleNotifyOut("127.0.0.1:53") //
 	if err := handleXfrOut(d, i); err != nil {
-                fmt.Printf("err %v\n", err)
+                r.Trace = append(r.Trace, "xfr err: "+err.String())
         }
         if Zone.name != "" {
-                // We have transfered a zone and can check it. For now assume ok.
-                Zone.correct = false
+                // We have transfered a zone: validate the DNSSEC chain
+                // from the apex down, including NSEC/NSEC3 coverage,
+                // before trusting anything in it.
+                Zone.correct = validateZone(Zone.name, Zone.allRRs())
+                if Zone.correct {
+                        handleNotifyOut("127.0.0.1:53")
+                        r.Trace = append(r.Trace, "zone validated, notify sent")
+                } else {
+                        r.Trace = append(r.Trace, "zone did not validate, not notifying")
+                }
         }
 }
 
+// proto reports whether d is a TCP or UDP connection, for the qlog
+// record.
+func proto(d *dns.Conn) string {
+	if d.Tcp {
+		return "tcp"
+	}
+	return "udp"
+}
+
 func listen(tcp string, addr string, e chan os.Error) {
 	switch tcp {
 	case "tcp":
@@ -68,8 +138,21 @@ func query(tcp string, e chan os.Error) {
 }
 
 func main() {
+	flag.Parse()
 	err := make(chan os.Error)
 
+	if aerr := loadTrustAnchors(*anchorFile); aerr != nil {
+		fmt.Printf("no usable trust anchors in %s: %v\n", *anchorFile, aerr)
+	}
+
+	loadTsigKeys(*tsigKeyFlag)
+
+	if backend, qerr := qlog.Open(*qlogSpec); qerr != nil {
+		fmt.Printf("qlog: %v\n", qerr)
+	} else {
+		qlog.SetBackend(backend)
+	}
+
 	// Outgoing queries
         dns.InitQueryChannels()
 	go query("tcp", err)
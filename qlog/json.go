@@ -0,0 +1,47 @@
+package qlog
+
+// The line-oriented JSON backend, one object per line so the output
+// is friendly to jq/ELK-style pipelines. We hand-roll the encoding
+// rather than reflecting over *Record: Msg doesn't have JSON tags
+// and most of its detail (full RR sections) isn't useful for this
+// summary line anyway.
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+type jsonBackend struct {
+	w io.Writer
+}
+
+// NewJSONBackend writes one JSON object per Record to w.
+func NewJSONBackend(w io.Writer) Backend {
+	return &jsonBackend{w}
+}
+
+func (b *jsonBackend) Log(r *Record) {
+	qname, qtype := "", "0"
+	if r.In != nil && len(r.In.Question) > 0 {
+		qname = r.In.Question[0].Qname
+		qtype = fmt.Sprintf("%d", r.In.Question[0].Qtype)
+	}
+	rcode := 0
+	if r.Out != nil {
+		rcode = r.Out.MsgHdr.Rcode
+	}
+	fmt.Fprintf(b.w,
+		`{"time":%d,"client":%q,"proto":%q,"qname":%q,"qtype":%s,"rcode":%d,`+
+			`"upstream":%q,"rtt_ms":%d,"tsig":%q,"ad":%v,"cd":%v,"trace":[%s]}`+"\n",
+		r.Time, r.Client, r.Proto, qname, qtype, rcode,
+		r.Upstream, r.RttMs, r.Tsig, r.AD, r.CD, jsonTrace(r.Trace))
+}
+
+func jsonTrace(trace []string) string {
+	quoted := make([]string, len(trace))
+	for i, t := range trace {
+		quoted[i] = fmt.Sprintf("%q", t)
+	}
+	return strings.Join(quoted, ",")
+}
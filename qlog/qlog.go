@@ -0,0 +1,87 @@
+// Package qlog is a structured query-logging subsystem shared by
+// xfrprx, Funkensturm and the dns server: any Handler can build one
+// Record per query/response pair and hand it to the active backend,
+// instead of reaching for fmt.Printf directly.
+package qlog
+
+import (
+	"dns"
+	"os"
+	"time"
+)
+
+// Record is everything worth knowing about one query/response pair.
+// Fields that don't apply to a given caller (Upstream on the plain
+// server, for instance) are left at their zero value.
+type Record struct {
+	Time     int64    // time.Nanoseconds() when the record was built
+	Client   string   // remote address of the original requester
+	Proto    string   // "udp" or "tcp"
+	In       *dns.Msg // the inbound query
+	Out      *dns.Msg // the outbound reply, nil if none was sent
+	Upstream string   // which upstream answered, for Funkensturm
+	RttMs    int64    // round trip to the upstream, 0 if not applicable
+	Tsig     string   // TSIG status, e.g. "NOERROR", "BADSIG", "" if unsigned
+	AD       bool     // AuthenticatedData bit on Out
+	CD       bool     // CheckingDisabled bit on In
+	Trace    []string // match/action names applied, in order
+}
+
+// Backend is something a Record can be handed to. Log must not
+// retain pkt/msg slices beyond the call since callers may reuse them.
+type Backend interface {
+	Log(r *Record)
+}
+
+// active is the backend every Log call is routed to; it defaults to
+// a no-op so packages can call qlog.Log unconditionally before
+// SetBackend has run (e.g. during early startup).
+var active Backend = noopBackend{}
+
+type noopBackend struct{}
+
+func (noopBackend) Log(r *Record) {}
+
+// SetBackend installs b as the destination for future Log calls.
+func SetBackend(b Backend) {
+	active = b
+}
+
+// Log records r through the active backend.
+func Log(r *Record) {
+	active.Log(r)
+}
+
+// NewRecord fills in Time and the AD/CD bits from in/out, leaving
+// the rest for the caller to set.
+func NewRecord(client, proto string, in, out *dns.Msg) *Record {
+	r := &Record{
+		Time:   time.Nanoseconds(),
+		Client: client,
+		Proto:  proto,
+		In:     in,
+		Out:    out,
+	}
+	if in != nil {
+		r.CD = in.MsgHdr.CheckingDisabled
+	}
+	if out != nil {
+		r.AD = out.MsgHdr.AuthenticatedData
+	}
+	return r
+}
+
+// Open selects a Backend by the name used on the -qlog flag, e.g.
+// "text", "json" or "dnstap:/var/run/qlog.sock".
+func Open(spec string) (Backend, os.Error) {
+	if spec == "" || spec == "text" {
+		return NewTextBackend(os.Stdout), nil
+	}
+	if spec == "json" {
+		return NewJSONBackend(os.Stdout), nil
+	}
+	if len(spec) > 7 && spec[0:7] == "dnstap:" {
+		return DialDnstap(spec[7:])
+	}
+	return nil, os.NewError("qlog: unknown backend spec " + spec)
+}
@@ -0,0 +1,39 @@
+package qlog
+
+// The human-readable backend: this is "verbose mode" from xfrprx and
+// Funkensturm, just routed through qlog.Log instead of scattered
+// fmt.Printf calls.
+
+import (
+	"fmt"
+	"io"
+)
+
+type textBackend struct {
+	w io.Writer
+}
+
+// NewTextBackend writes one multi-line block per record to w.
+func NewTextBackend(w io.Writer) Backend {
+	return &textBackend{w}
+}
+
+func (b *textBackend) Log(r *Record) {
+	fmt.Fprintf(b.w, ">>>>>> %s %s %s\n", r.Proto, r.Client, r.Upstream)
+	if r.In != nil {
+		fmt.Fprintf(b.w, "%v", r.In)
+	}
+	if r.Out != nil {
+		fmt.Fprintf(b.w, "---\n%v", r.Out)
+	}
+	if r.Tsig != "" {
+		fmt.Fprintf(b.w, "tsig: %s\n", r.Tsig)
+	}
+	if r.RttMs != 0 {
+		fmt.Fprintf(b.w, "rtt: %dms\n", r.RttMs)
+	}
+	if len(r.Trace) > 0 {
+		fmt.Fprintf(b.w, "trace: %v\n", r.Trace)
+	}
+	fmt.Fprintf(b.w, "AD=%v CD=%v\n<<<<<<\n\n", r.AD, r.CD)
+}
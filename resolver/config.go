@@ -2,11 +2,12 @@
 // Use of this source code is governed by a BSD-style
 // license that can be found in the LICENSE file.
 
-// Read system DNS config from /etc/resolv.conf
+// Read system DNS config from /etc/resolv.conf, RES_OPTIONS /
+// RES_NAMESERVERS / LOCALDOMAIN, and /etc/hosts.
 
 package resolver
 
-import ( "os"; "net" )
+import ( "os"; "net"; "strings" )
 
 // See resolv.conf(5) on a Linux machine.
 // TODO(rsc): Supposed to call uname() and chop the beginning
@@ -17,7 +18,7 @@ func (r *Resolver) FromFile(conf string) os.Error {
 	if err != nil {
 		return err
 	}
-	r.Servers = make([]string, 3)[0:0] // small, but the standard limit
+	r.Servers = make([]string, 0, 3)
 	r.Search = make([]string, 0)
 	r.Ndots = 1
 	r.Timeout = 5
@@ -30,22 +31,8 @@ func (r *Resolver) FromFile(conf string) os.Error {
 		}
 		switch f[0] {
 		case "nameserver": // add one name server
-			a := r.Servers
-			n := len(a)
-			if len(f) > 1 && n < cap(a) {
-				// One more check: make sure server name is
-				// just an IP address.  Otherwise we need DNS
-				// to look it up.
-				name := f[1]
-				switch len(net.ParseIP(name)) {
-				case 16:
-					name = "[" + name + "]"
-					fallthrough
-				case 4:
-					a = a[0 : n+1]
-					a[n] = name
-					r.Servers = a
-				}
+			if len(f) > 1 {
+				addServer(r, f[1])
 			}
 
 		case "domain": // set search path to just this domain
@@ -63,33 +50,187 @@ func (r *Resolver) FromFile(conf string) os.Error {
 			}
 
 		case "options": // magic options
-			for i := 1; i < len(f); i++ {
-				s := f[i]
-				switch {
-				case len(s) >= 6 && s[0:6] == "ndots:":
-					n, _, _ := dtoi(s, 6)
-					if n < 1 {
-						n = 1
-					}
-					r.Ndots = n
-				case len(s) >= 8 && s[0:8] == "timeout:":
-					n, _, _ := dtoi(s, 8)
-					if n < 1 {
-						n = 1
-					}
-					r.Timeout = n
-				case len(s) >= 8 && s[0:9] == "attempts:":
-					n, _, _ := dtoi(s, 9)
-					if n < 1 {
-						n = 1
-					}
-					r.Attempts = n
-				case s == "rotate":
-					r.Rotate = true
-				}
-			}
+			parseOptions(r, f[1:])
 		}
 	}
 	file.close()
+
+	overlayEnv(r)
+
+	if r.Hosts == nil {
+		r.Hosts = loadHosts(hostsFile())
+	}
+
 	return nil
-}
\ No newline at end of file
+}
+
+// addServer appends name to r.Servers, growing the slice as needed
+// (resolv.conf has no hard limit on the number of nameserver lines).
+// It accepts a bracketed, possibly scoped, IPv6 literal such as
+// "[fe80::1%eth0]" as well as a bare IPv4/IPv6 address.
+func addServer(r *Resolver, name string) {
+	host := name
+	if len(host) > 0 && host[0] == '[' && host[len(host)-1] == ']' {
+		host = host[1 : len(host)-1]
+	}
+	addr := host
+	if i := strings.Index(host, "%"); i >= 0 {
+		addr = host[0:i] // net.ParseIP doesn't understand zone IDs
+	}
+	ip := net.ParseIP(addr)
+	switch {
+	case ip != nil && ip.To4() == nil:
+		r.Servers = append(r.Servers, "["+host+"]")
+	case ip != nil:
+		// ParseIP returns a 16-byte slice for IPv4 too; To4 tells
+		// the families apart.
+		r.Servers = append(r.Servers, host)
+	default:
+		// Not a literal address; resolv.conf allows this in
+		// theory but we have no resolver to look it up with yet,
+		// so just record it verbatim like glibc's ns_addr does.
+		r.Servers = append(r.Servers, host)
+	}
+}
+
+// parseOptions fills in the fields of r corresponding to the
+// "options" line of resolv.conf: ndots/timeout/attempts/rotate plus
+// the remaining glibc options.
+func parseOptions(r *Resolver, f []string) {
+	for i := 0; i < len(f); i++ {
+		s := f[i]
+		switch {
+		case len(s) >= 6 && s[0:6] == "ndots:":
+			n, _, _ := dtoi(s, 6)
+			if n < 1 {
+				n = 1
+			}
+			r.Ndots = n
+		case len(s) >= 8 && s[0:8] == "timeout:":
+			n, _, _ := dtoi(s, 8)
+			if n < 1 {
+				n = 1
+			}
+			r.Timeout = n
+		case len(s) >= 9 && s[0:9] == "attempts:":
+			n, _, _ := dtoi(s, 9)
+			if n < 1 {
+				n = 1
+			}
+			r.Attempts = n
+		case s == "rotate":
+			r.Rotate = true
+		case s == "single-request":
+			r.SingleRequest = true
+		case s == "single-request-reopen":
+			r.SingleRequestReopen = true
+		case s == "use-vc":
+			r.UseVC = true
+		case s == "no-tld-query":
+			r.NoTldQuery = true
+		case s == "edns0":
+			r.Edns0 = true
+		case s == "trust-ad":
+			r.TrustAD = true
+		case s == "no-reload":
+			r.NoReload = true
+		case s == "ip6-bytestring":
+			r.IP6Bytestring = true
+		}
+	}
+}
+
+// overlayEnv applies the RES_OPTIONS, LOCALDOMAIN and RES_NAMESERVERS
+// environment variables on top of whatever FromFile just parsed,
+// matching glibc's precedence (the environment always wins).
+func overlayEnv(r *Resolver) {
+	if opts := os.Getenv("RES_OPTIONS"); opts != "" {
+		parseOptions(r, getFields(opts))
+	}
+	if dom := os.Getenv("LOCALDOMAIN"); dom != "" {
+		// glibc treats LOCALDOMAIN as a space-separated search
+		// list, not a single domain.
+		r.Search = getFields(dom)
+	}
+	if ns := os.Getenv("RES_NAMESERVERS"); ns != "" {
+		r.Servers = make([]string, 0, 3)
+		for _, f := range getFields(ns) {
+			addServer(r, f)
+		}
+	}
+}
+
+// hostsFile returns the /etc/hosts-equivalent path to load, honoring
+// HOSTALIASES the same way the glibc resolver does.
+func hostsFile() string {
+	if h := os.Getenv("HOSTALIASES"); h != "" {
+		return h
+	}
+	return "/etc/hosts"
+}
+
+// loadHosts reads an /etc/hosts-style file into an address-family
+// keyed lookup table: hosts["a"]["host.example."] and
+// hosts["aaaa"]["host.example."] hold the IPv4/IPv6 literals for
+// that name, and hosts["ptr"][addr] holds the name(s) for a reverse
+// lookup. A Resolver consults this map before ever sending an A,
+// AAAA or PTR query over the wire.
+func loadHosts(path string) map[string]map[string][]string {
+	hosts := map[string]map[string][]string{
+		"a": {}, "aaaa": {}, "ptr": {},
+	}
+	file, err := open(path)
+	if err != nil {
+		return hosts
+	}
+	defer file.close()
+	for line, ok := file.readLine(); ok; line, ok = file.readLine() {
+		f := getFields(line)
+		if len(f) < 2 {
+			continue
+		}
+		ip := net.ParseIP(f[0])
+		if ip == nil {
+			continue
+		}
+		family := "a"
+		if len(ip) == 16 && ip.To4() == nil {
+			family = "aaaa"
+		}
+		for _, name := range f[1:] {
+			fqdn := name
+			if len(fqdn) == 0 || fqdn[len(fqdn)-1] != '.' {
+				fqdn = fqdn + "."
+			}
+			hosts[family][fqdn] = append(hosts[family][fqdn], f[0])
+			hosts["ptr"][f[0]] = append(hosts["ptr"][f[0]], fqdn)
+		}
+	}
+	return hosts
+}
+
+// LookupHost short-circuits an A/AAAA/PTR lookup against the loaded
+// /etc/hosts map, so FromFile's caller never has to hit the wire for
+// names (or addresses) listed there. qtype is "a", "aaaa" or "ptr".
+func (r *Resolver) LookupHost(qtype, name string) ([]string, bool) {
+	if r.Hosts == nil {
+		return nil, false
+	}
+	v, ok := r.Hosts[qtype][name]
+	return v, ok
+}
+
+// Server returns the next nameserver to query. When Rotate is set
+// each call advances round-robin through r.Servers; otherwise the
+// first server is always preferred, as resolv.conf documents.
+func (r *Resolver) Server() string {
+	if len(r.Servers) == 0 {
+		return ""
+	}
+	if !r.Rotate {
+		return r.Servers[0]
+	}
+	s := r.Servers[r.next%len(r.Servers)]
+	r.next++
+	return s
+}
@@ -0,0 +1,103 @@
+package resolver
+
+import (
+	"os"
+	"testing"
+)
+
+func fromFile(t *testing.T, path string) *Resolver {
+	r := new(Resolver)
+	if err := r.FromFile(path); err != nil {
+		t.Fatalf("FromFile(%s): %v", path, err)
+	}
+	return r
+}
+
+func TestOptions(t *testing.T) {
+	r := fromFile(t, "testdata/options.conf")
+	if r.Ndots != 3 {
+		t.Errorf("Ndots = %d, want 3", r.Ndots)
+	}
+	if r.Timeout != 2 {
+		t.Errorf("Timeout = %d, want 2", r.Timeout)
+	}
+	if r.Attempts != 4 {
+		t.Errorf("Attempts = %d, want 4", r.Attempts)
+	}
+	if !r.SingleRequest || !r.SingleRequestReopen || !r.UseVC || !r.NoTldQuery ||
+		!r.Edns0 || !r.TrustAD || !r.NoReload || !r.IP6Bytestring {
+		t.Errorf("not all glibc options were parsed: %+v", r)
+	}
+}
+
+func TestMoreThanThreeServers(t *testing.T) {
+	r := fromFile(t, "testdata/rotate.conf")
+	if len(r.Servers) != 4 {
+		t.Fatalf("Servers = %v, want 4 entries", r.Servers)
+	}
+}
+
+func TestRotate(t *testing.T) {
+	r := fromFile(t, "testdata/rotate.conf")
+	if !r.Rotate {
+		t.Fatalf("Rotate = false, want true")
+	}
+	seen := map[string]bool{}
+	for i := 0; i < len(r.Servers); i++ {
+		seen[r.Server()] = true
+	}
+	if len(seen) != len(r.Servers) {
+		t.Errorf("rotate did not cycle through all servers: %v", seen)
+	}
+}
+
+func TestNoRotatePrefersFirst(t *testing.T) {
+	r := fromFile(t, "testdata/options.conf")
+	first := r.Server()
+	if first != r.Servers[0] || r.Server() != first {
+		t.Errorf("without rotate, Server() should always return Servers[0]")
+	}
+}
+
+func TestScopedIPv6(t *testing.T) {
+	r := fromFile(t, "testdata/ipv6.conf")
+	if len(r.Servers) != 2 {
+		t.Fatalf("Servers = %v, want 2 entries", r.Servers)
+	}
+	if r.Servers[0] != "[fe80::1%eth0]" {
+		t.Errorf("Servers[0] = %q, want bracketed scoped address", r.Servers[0])
+	}
+}
+
+func TestEnvOverride(t *testing.T) {
+	os.Setenv("RES_OPTIONS", "ndots:9")
+	os.Setenv("RES_NAMESERVERS", "198.51.100.1 198.51.100.2")
+	os.Setenv("LOCALDOMAIN", "override.example.")
+	defer os.Setenv("RES_OPTIONS", "")
+	defer os.Setenv("RES_NAMESERVERS", "")
+	defer os.Setenv("LOCALDOMAIN", "")
+
+	r := fromFile(t, "testdata/options.conf")
+	if r.Ndots != 9 {
+		t.Errorf("Ndots = %d, want 9 (env should win)", r.Ndots)
+	}
+	if len(r.Servers) != 2 || r.Servers[0] != "198.51.100.1" {
+		t.Errorf("Servers = %v, want RES_NAMESERVERS to win", r.Servers)
+	}
+	if len(r.Search) != 1 || r.Search[0] != "override.example." {
+		t.Errorf("Search = %v, want LOCALDOMAIN to win", r.Search)
+	}
+}
+
+func TestHosts(t *testing.T) {
+	hosts := loadHosts("testdata/hosts")
+	if hosts["a"]["godns.example."] == nil {
+		t.Fatalf("godns.example. missing from hosts[a]: %v", hosts["a"])
+	}
+	if hosts["a"]["godns.example."][0] != "192.0.2.42" {
+		t.Errorf("godns.example. = %v, want 192.0.2.42", hosts["a"]["godns.example."])
+	}
+	if hosts["ptr"]["192.0.2.42"] == nil {
+		t.Errorf("reverse entry for 192.0.2.42 missing: %v", hosts["ptr"])
+	}
+}
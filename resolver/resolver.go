@@ -0,0 +1,30 @@
+// Copyright 2009 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package resolver
+
+// Resolver holds the knobs FromFile fills in from /etc/resolv.conf
+// (and its environment-variable overrides), plus the state Server()
+// needs to round-robin through them.
+type Resolver struct {
+	Servers  []string // servers to use
+	Search   []string // suffixes to append to local name
+	Ndots    int      // number of dots in name to trigger absolute lookup
+	Timeout  int      // seconds to wait for a reply before retrying
+	Attempts int      // lost packets before giving up on server
+	Rotate   bool     // round robin among servers
+
+	SingleRequest       bool // use separate socket for A and AAAA requests
+	SingleRequestReopen bool // reopen the socket between A and AAAA requests
+	UseVC               bool // always use TCP
+	NoTldQuery          bool // do not look up unqualified names as a TLD
+	Edns0               bool // add an EDNS0 OPT record to every query
+	TrustAD             bool // set the AD bit and trust its value in replies
+	NoReload            bool // do not check resolv.conf for changes
+	IP6Bytestring       bool // use the deprecated "bit string" AAAA lookup format
+
+	Hosts map[string]map[string][]string // loaded /etc/hosts, see loadHosts
+
+	next int // round-robin cursor for Server()
+}
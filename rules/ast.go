@@ -0,0 +1,57 @@
+package rules
+
+// AST for the rule language and the glue types used to hand parsed
+// rules back to Funkensturm's []Match / []Action slices without the
+// rules package needing to import "main".
+
+import "dns"
+
+// Direction mirrors Funkensturm's IN/OUT constants so a caller can
+// pass them straight through to a compiled MatchFunc.
+const (
+	IN = iota
+	OUT
+)
+
+// MatchFunc and ActionFunc have the exact signatures of
+// Match.Func and Action.Func in funkensturm.go.
+type MatchFunc func(m *dns.Msg, dir int) (*dns.Msg, bool)
+type ActionFunc func(m *dns.Msg, ok bool) *dns.Msg
+
+// Rule is one compiled "if ... then ..." statement: a single
+// condition (already folded down to one MatchFunc) and the ordered
+// actions to run when it is reached.
+type Rule struct {
+	Cond    MatchFunc
+	Actions []ActionFunc
+}
+
+// cond is the boolean expression AST: a leaf predicate, a negation,
+// or an AND/OR of two sub-conditions.
+type cond interface {
+	eval(m *dns.Msg) bool
+}
+
+type andCond struct{ l, r cond }
+type orCond struct{ l, r cond }
+type notCond struct{ c cond }
+
+func (c *andCond) eval(m *dns.Msg) bool { return c.l.eval(m) && c.r.eval(m) }
+func (c *orCond) eval(m *dns.Msg) bool  { return c.l.eval(m) || c.r.eval(m) }
+func (c *notCond) eval(m *dns.Msg) bool { return !c.c.eval(m) }
+
+// predicate is a single field/op/value test, e.g. `qtype == A` or
+// `qname matches "*.example.com"`.
+type predicate struct {
+	field string
+	op    tokKind // tEq, tNeq or tMatches
+	value string
+}
+
+// action is a single mutation or terminal action, e.g.
+// `rewrite answer.a = 10.0.0.1` or `forward to 8.8.8.8`.
+type action struct {
+	verb  string // rewrite, set-rcode, add, remove, strip-dnssec, forward, drop, respond-with
+	field string // for rewrite/remove: the dotted field path
+	value string
+}
@@ -0,0 +1,309 @@
+package rules
+
+// Evaluation: turning the parsed cond/action trees into the
+// MatchFunc/ActionFunc closures Funkensturm actually calls, and the
+// small runtime (glob, regex, field lookup) they lean on.
+
+import (
+	"dns"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Load reads path and parses it into a set of rules, for use as the
+// body of a Funkensturm Match/Action pair (see the "rules" flag in
+// the funkensturm command).
+func Load(path string) ([]*Rule, os.Error) {
+	buf, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return Parse(string(buf))
+}
+
+// compileCond turns a cond AST into the MatchFunc Funkensturm calls
+// for every packet; dir (IN/OUT) is ignored, every predicate is
+// evaluated against m as given, inbound or outbound alike.
+func compileCond(c cond) MatchFunc {
+	return func(m *dns.Msg, dir int) (*dns.Msg, bool) {
+		return m, c.eval(m)
+	}
+}
+
+func (pr *predicate) eval(m *dns.Msg) bool {
+	value := fieldValue(m, pr.field)
+	switch pr.op {
+	case tEq:
+		return value == pr.value
+	case tNeq:
+		return value != pr.value
+	case tMatches:
+		if pr.field == "rdata" {
+			ok, _ := regexp.MatchString(pr.value, value)
+			return ok
+		}
+		return globMatch(pr.value, value)
+	}
+	return false
+}
+
+// fieldValue reads one of the predicate fields out of m as a string
+// so it can be compared/matched uniformly.
+func fieldValue(m *dns.Msg, field string) string {
+	switch field {
+	case "qname":
+		if len(m.Question) > 0 {
+			return m.Question[0].Qname
+		}
+	case "qtype":
+		if len(m.Question) > 0 {
+			return dns.TypeToString[m.Question[0].Qtype]
+		}
+	case "qclass":
+		if len(m.Question) > 0 {
+			return dns.ClassToString[m.Question[0].Qclass]
+		}
+	case "opcode":
+		return strconv.Itoa(m.MsgHdr.Opcode)
+	case "rcode":
+		return strconv.Itoa(m.MsgHdr.Rcode)
+	case "response":
+		return strconv.Btoa(m.MsgHdr.Response)
+	case "do":
+		return strconv.Btoa(msgDO(m))
+	case "rdata":
+		return rdataString(m)
+	}
+	return ""
+}
+
+// msgDO reports the state of the EDNS0 DO (DNSSEC OK) bit, if the
+// message carries an OPT record at all.
+func msgDO(m *dns.Msg) bool {
+	for _, rr := range m.Extra {
+		if opt, ok := rr.(*dns.RR_OPT); ok {
+			return opt.Do()
+		}
+	}
+	return false
+}
+
+// rdataString concatenates the rdata of every answer/authority/extra
+// RR, for the "rdata matches ..." predicate.
+func rdataString(m *dns.Msg) string {
+	parts := make([]string, 0)
+	for _, rr := range m.Answer {
+		parts = append(parts, rr.String())
+	}
+	for _, rr := range m.Ns {
+		parts = append(parts, rr.String())
+	}
+	for _, rr := range m.Extra {
+		parts = append(parts, rr.String())
+	}
+	return strings.Join(parts, "\n")
+}
+
+// globMatch implements the small "*.example.com"-style glob used by
+// qname/qtype/qclass predicates: '*' matches any run of characters,
+// everything else is literal (case-insensitive, as DNS names are).
+func globMatch(pattern, s string) bool {
+	pattern = strings.ToLower(pattern)
+	s = strings.ToLower(s)
+	return globMatchLower(pattern, s)
+}
+
+func globMatchLower(pattern, s string) bool {
+	if pattern == "" {
+		return s == ""
+	}
+	if pattern[0] == '*' {
+		if globMatchLower(pattern[1:], s) {
+			return true
+		}
+		for i := 0; i < len(s); i++ {
+			if globMatchLower(pattern[1:], s[i+1:]) {
+				return true
+			}
+		}
+		return pattern[1:] == "" || globMatchLower(pattern[1:], "")
+	}
+	if s == "" {
+		return false
+	}
+	if pattern[0] != s[0] {
+		return false
+	}
+	return globMatchLower(pattern[1:], s[1:])
+}
+
+// compileAction turns an action AST node into the ActionFunc
+// Funkensturm calls once matching has decided "ok" for a packet.
+func compileAction(a *action) ActionFunc {
+	switch a.verb {
+	case "rewrite":
+		return func(m *dns.Msg, ok bool) *dns.Msg {
+			if ok {
+				rewriteField(m, a.field, a.value)
+			}
+			return m
+		}
+	case "remove":
+		return func(m *dns.Msg, ok bool) *dns.Msg {
+			if ok {
+				removeField(m, a.field)
+			}
+			return m
+		}
+	case "strip-dnssec":
+		return func(m *dns.Msg, ok bool) *dns.Msg {
+			if ok {
+				stripDNSSEC(m)
+			}
+			return m
+		}
+	case "set-rcode":
+		return func(m *dns.Msg, ok bool) *dns.Msg {
+			if ok {
+				n, _ := strconv.Atoi(a.value)
+				m.MsgHdr.Rcode = n
+			}
+			return m
+		}
+	case "add":
+		return func(m *dns.Msg, ok bool) *dns.Msg {
+			if ok {
+				if rr, err := dns.NewRR(a.value); err == nil {
+					m.Answer = append(m.Answer, rr)
+				}
+			}
+			return m
+		}
+	case "drop":
+		return func(m *dns.Msg, ok bool) *dns.Msg {
+			if ok {
+				return nil
+			}
+			return m
+		}
+	case "forward":
+		return func(m *dns.Msg, ok bool) *dns.Msg {
+			if ok {
+				forwardTo(m, a.value)
+			}
+			return m
+		}
+	case "respond-with":
+		return func(m *dns.Msg, ok bool) *dns.Msg {
+			if ok {
+				if rr, err := dns.NewRR(a.value); err == nil {
+					m.MsgHdr.Response = true
+					m.Answer = []dns.RR{rr}
+				}
+			}
+			return m
+		}
+	}
+	return func(m *dns.Msg, ok bool) *dns.Msg { return m }
+}
+
+// rewriteField implements "rewrite answer.a = 10.0.0.1" and
+// "rewrite name = foo.example.com.": answer.<type> rewrites the
+// rdata of the first matching answer RR, name rewrites the question.
+func rewriteField(m *dns.Msg, field, value string) {
+	if field == "name" {
+		if len(m.Question) > 0 {
+			m.Question[0].Qname = value
+		}
+		return
+	}
+	parts := strings.Split(field, ".", -1)
+	if len(parts) != 2 || parts[0] != "answer" {
+		return
+	}
+	t, ok := dns.StringToType[strings.ToUpper(parts[1])]
+	if !ok {
+		return
+	}
+	for _, rr := range m.Answer {
+		if rr.Header().Rrtype == t {
+			rr.SetRdata(value)
+			return
+		}
+	}
+}
+
+// removeField implements "remove answer.a" and friends by dropping
+// every RR of that type from the answer section; the first part of
+// the path is not checked, so it always acts on the answer section.
+func removeField(m *dns.Msg, field string) {
+	parts := strings.Split(field, ".", -1)
+	if len(parts) != 2 {
+		return
+	}
+	t, ok := dns.StringToType[strings.ToUpper(parts[1])]
+	if !ok {
+		return
+	}
+	kept := make([]dns.RR, 0, len(m.Answer))
+	for _, rr := range m.Answer {
+		if rr.Header().Rrtype != t {
+			kept = append(kept, rr)
+		}
+	}
+	m.Answer = kept
+}
+
+// stripDNSSEC drops RRSIG/NSEC/NSEC3/DNSKEY/DS records from every
+// section and clears the EDNS0 DO bit, so downstream resolvers that
+// don't want DNSSEC never see it.
+func stripDNSSEC(m *dns.Msg) {
+	m.Answer = stripDNSSECSection(m.Answer)
+	m.Ns = stripDNSSECSection(m.Ns)
+	kept := make([]dns.RR, 0, len(m.Extra))
+	for _, rr := range m.Extra {
+		if opt, ok := rr.(*dns.RR_OPT); ok {
+			opt.SetDo(false)
+			kept = append(kept, opt)
+			continue
+		}
+		if isDNSSECType(rr.Header().Rrtype) {
+			continue
+		}
+		kept = append(kept, rr)
+	}
+	m.Extra = kept
+}
+
+func stripDNSSECSection(rrs []dns.RR) []dns.RR {
+	kept := make([]dns.RR, 0, len(rrs))
+	for _, rr := range rrs {
+		if !isDNSSECType(rr.Header().Rrtype) {
+			kept = append(kept, rr)
+		}
+	}
+	return kept
+}
+
+func isDNSSECType(t uint16) bool {
+	switch t {
+	case dns.TypeRRSIG, dns.TypeNSEC, dns.TypeNSEC3, dns.TypeNSEC3PARAM, dns.TypeDNSKEY, dns.TypeDS:
+		return true
+	}
+	return false
+}
+
+// forwardTo is filled in by the caller (see SetForwarder): the rule
+// language itself has no notion of an upstream pool, it just records
+// which address a "forward to" action asked for.
+var forwardTo = func(m *dns.Msg, addr string) {}
+
+// SetForwarder lets the embedder (Funkensturm's send()) decide what
+// "forward to <addr>" actually does, e.g. looking addr up in its
+// resolver pool, without the rules package importing that pool.
+func SetForwarder(f func(m *dns.Msg, addr string)) {
+	forwardTo = f
+}
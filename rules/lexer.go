@@ -0,0 +1,167 @@
+package rules
+
+// A small hand-written lexer for the Funkensturm rule language, e.g.
+//
+//	if qname matches "*.example.com" and qtype == A then
+//		rewrite answer.a = 10.0.0.1; forward to 8.8.8.8
+//
+// One rule per "if ... then ..." statement; rules are separated by
+// whitespace/newlines in the source file.
+
+import (
+	"os"
+	"strings"
+)
+
+type tokKind int
+
+const (
+	tEOF tokKind = iota
+	tIdent
+	tString
+	tNumber
+	tIf
+	tThen
+	tAnd
+	tOr
+	tNot
+	tEq    // ==
+	tNeq   // !=
+	tAssign // =
+	tMatches
+	tDot
+	tSemi
+	tLparen
+	tRparen
+)
+
+var keywords = map[string]tokKind{
+	"if":      tIf,
+	"then":    tThen,
+	"and":     tAnd,
+	"or":      tOr,
+	"not":     tNot,
+	"matches": tMatches,
+}
+
+type token struct {
+	kind tokKind
+	text string
+}
+
+type lexer struct {
+	src  string
+	pos  int
+	toks []token
+}
+
+func newLexer(src string) *lexer {
+	return &lexer{src: src}
+}
+
+// lex tokenizes the whole input up front; the rule language is small
+// enough that a lookahead-of-N parser over a token slice is simpler
+// than threading position state through the parser.
+func (l *lexer) lex() ([]token, os.Error) {
+	for l.pos < len(l.src) {
+		c := l.src[l.pos]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			l.pos++
+		case c == '#':
+			for l.pos < len(l.src) && l.src[l.pos] != '\n' {
+				l.pos++
+			}
+		case c == '"':
+			s, err := l.lexString()
+			if err != nil {
+				return nil, err
+			}
+			l.toks = append(l.toks, token{tString, s})
+		case c == '.':
+			l.toks = append(l.toks, token{tDot, "."})
+			l.pos++
+		case c == ';':
+			l.toks = append(l.toks, token{tSemi, ";"})
+			l.pos++
+		case c == '(':
+			l.toks = append(l.toks, token{tLparen, "("})
+			l.pos++
+		case c == ')':
+			l.toks = append(l.toks, token{tRparen, ")"})
+			l.pos++
+		case c == '=':
+			if l.peek(1) == '=' {
+				l.toks = append(l.toks, token{tEq, "=="})
+				l.pos += 2
+			} else {
+				l.toks = append(l.toks, token{tAssign, "="})
+				l.pos++
+			}
+		case c == '!' && l.peek(1) == '=':
+			l.toks = append(l.toks, token{tNeq, "!="})
+			l.pos += 2
+		case isIdentStart(c) || c == '*' || c == '-':
+			l.toks = append(l.toks, l.lexIdent())
+		case isDigit(c):
+			l.toks = append(l.toks, l.lexNumber())
+		default:
+			return nil, os.NewError("rules: unexpected character '" + string(c) + "'")
+		}
+	}
+	l.toks = append(l.toks, token{tEOF, ""})
+	return l.toks, nil
+}
+
+func (l *lexer) peek(off int) byte {
+	if l.pos+off >= len(l.src) {
+		return 0
+	}
+	return l.src[l.pos+off]
+}
+
+func (l *lexer) lexString() (string, os.Error) {
+	start := l.pos + 1
+	l.pos++
+	for l.pos < len(l.src) && l.src[l.pos] != '"' {
+		l.pos++
+	}
+	if l.pos >= len(l.src) {
+		return "", os.NewError("rules: unterminated string literal")
+	}
+	s := l.src[start:l.pos]
+	l.pos++
+	return s, nil
+}
+
+func (l *lexer) lexIdent() token {
+	start := l.pos
+	for l.pos < len(l.src) && (isIdentPart(l.src[l.pos]) || l.src[l.pos] == '-' || l.src[l.pos] == '*') {
+		l.pos++
+	}
+	text := l.src[start:l.pos]
+	if k, ok := keywords[strings.ToLower(text)]; ok {
+		return token{k, text}
+	}
+	return token{tIdent, text}
+}
+
+func (l *lexer) lexNumber() token {
+	start := l.pos
+	for l.pos < len(l.src) && (isDigit(l.src[l.pos]) || l.src[l.pos] == '.') {
+		l.pos++
+	}
+	return token{tNumber, l.src[start:l.pos]}
+}
+
+func isIdentStart(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isIdentPart(c byte) bool {
+	return isIdentStart(c) || isDigit(c) || c == ':' || c == '%' || c == '/'
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
@@ -0,0 +1,218 @@
+package rules
+
+// Recursive-descent parser turning a token stream into a slice of
+// Rule. Grammar (informal):
+//
+//	rules    := rule*
+//	rule     := "if" orExpr "then" actionList
+//	orExpr   := andExpr ("or" andExpr)*
+//	andExpr  := unary ("and" unary)*
+//	unary    := "not" unary | "(" orExpr ")" | predicate
+//	predicate:= ident ("matches" | "==" | "!=") (string | ident | number)
+//	actionList := action (";" action)*
+//	action   := "rewrite" path "=" value
+//	          | "set-rcode" value
+//	          | "add" value
+//	          | "remove" path
+//	          | "strip-dnssec"
+//	          | "forward" "to"? value
+//	          | "drop"
+//	          | "respond-with" value
+
+import "os"
+
+type parser struct {
+	toks []token
+	pos  int
+}
+
+// Parse reads the whole rule-language source in src and returns the
+// compiled rules, in file order.
+func Parse(src string) ([]*Rule, os.Error) {
+	toks, err := newLexer(src).lex()
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{toks: toks}
+	rules := make([]*Rule, 0)
+	for p.cur().kind != tEOF {
+		r, err := p.parseRule()
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, r)
+	}
+	return rules, nil
+}
+
+func (p *parser) cur() token  { return p.toks[p.pos] }
+func (p *parser) advance() token {
+	t := p.toks[p.pos]
+	if p.pos < len(p.toks)-1 {
+		p.pos++
+	}
+	return t
+}
+
+func (p *parser) expect(k tokKind, what string) (token, os.Error) {
+	if p.cur().kind != k {
+		return token{}, os.NewError("rules: expected " + what + ", got '" + p.cur().text + "'")
+	}
+	return p.advance(), nil
+}
+
+func (p *parser) parseRule() (*Rule, os.Error) {
+	if _, err := p.expect(tIf, "'if'"); err != nil {
+		return nil, err
+	}
+	c, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := p.expect(tThen, "'then'"); err != nil {
+		return nil, err
+	}
+	actions, err := p.parseActionList()
+	if err != nil {
+		return nil, err
+	}
+	return &Rule{Cond: compileCond(c), Actions: actions}, nil
+}
+
+func (p *parser) parseOr() (cond, os.Error) {
+	l, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.cur().kind == tOr {
+		p.advance()
+		r, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		l = &orCond{l, r}
+	}
+	return l, nil
+}
+
+func (p *parser) parseAnd() (cond, os.Error) {
+	l, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for p.cur().kind == tAnd {
+		p.advance()
+		r, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		l = &andCond{l, r}
+	}
+	return l, nil
+}
+
+func (p *parser) parseUnary() (cond, os.Error) {
+	if p.cur().kind == tNot {
+		p.advance()
+		c, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &notCond{c}, nil
+	}
+	if p.cur().kind == tLparen {
+		p.advance()
+		c, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if _, err := p.expect(tRparen, "')'"); err != nil {
+			return nil, err
+		}
+		return c, nil
+	}
+	return p.parsePredicate()
+}
+
+func (p *parser) parsePredicate() (cond, os.Error) {
+	field, err := p.expect(tIdent, "a field name")
+	if err != nil {
+		return nil, err
+	}
+	op := p.cur().kind
+	if op != tMatches && op != tEq && op != tNeq {
+		return nil, os.NewError("rules: expected 'matches', '==' or '!=' after '" + field.text + "'")
+	}
+	p.advance()
+	value := p.advance().text
+	return &predicate{field.text, op, value}, nil
+}
+
+func (p *parser) parseActionList() ([]ActionFunc, os.Error) {
+	actions := make([]ActionFunc, 0)
+	for {
+		a, err := p.parseAction()
+		if err != nil {
+			return nil, err
+		}
+		actions = append(actions, compileAction(a))
+		if p.cur().kind != tSemi {
+			break
+		}
+		p.advance()
+	}
+	return actions, nil
+}
+
+func (p *parser) parseAction() (*action, os.Error) {
+	verb, err := p.expect(tIdent, "an action")
+	if err != nil {
+		return nil, err
+	}
+	switch verb.text {
+	case "rewrite", "remove":
+		path, err := p.parsePath()
+		if err != nil {
+			return nil, err
+		}
+		value := ""
+		if verb.text == "rewrite" {
+			if _, err := p.expect(tAssign, "'='"); err != nil {
+				return nil, err
+			}
+			value = p.advance().text
+		}
+		return &action{verb.text, path, value}, nil
+	case "set-rcode", "respond-with", "add":
+		value := p.advance().text
+		return &action{verb: verb.text, value: value}, nil
+	case "strip-dnssec", "drop":
+		return &action{verb: verb.text}, nil
+	case "forward":
+		// "forward to 8.8.8.8" - 'to' is an ordinary ident here.
+		if p.cur().kind == tIdent && p.cur().text == "to" {
+			p.advance()
+		}
+		value := p.advance().text
+		return &action{verb: "forward", value: value}, nil
+	}
+	return nil, os.NewError("rules: unknown action '" + verb.text + "'")
+}
+
+// parsePath reads a dotted field path such as answer.a or header.rcode.
+func (p *parser) parsePath() (string, os.Error) {
+	first, err := p.expect(tIdent, "a field path")
+	if err != nil {
+		return "", err
+	}
+	path := first.text
+	for p.cur().kind == tDot {
+		p.advance()
+		part, err := p.expect(tIdent, "a field name after '.'")
+		if err != nil {
+			return "", err
+		}
+		path = path + "." + part.text
+	}
+	return path, nil
+}
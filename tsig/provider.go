@@ -0,0 +1,54 @@
+// Package tsig is the server-side TSIG pipeline hinted at by the
+// commented-out TestResponderTsig in server_test.go: automatic
+// verification of an inbound request's TSIG, and automatic signing
+// of the reply, per RFC 8945.
+package tsig
+
+import "dns"
+
+// Provider looks up the shared secret for a TSIG key name. Secret
+// returns the algorithm (e.g. "hmac-sha256.") and base64-encoded
+// secret for keyname, or ok == false if the key is unknown.
+type Provider interface {
+	Secret(keyname string) (algo, secret string, ok bool)
+}
+
+// StaticProvider is a Provider backed by a fixed, in-memory map -
+// the common case of a handful of keys configured up front.
+type StaticProvider map[string]StaticKey
+
+// StaticKey is one entry in a StaticProvider.
+type StaticKey struct {
+	Algo   string
+	Secret string // base64-encoded
+}
+
+func (p StaticProvider) Secret(keyname string) (algo, secret string, ok bool) {
+	k, ok := p[keyname]
+	if !ok {
+		return "", "", false
+	}
+	return k.Algo, k.Secret, true
+}
+
+// HasTSIG reports whether m carries a trailing RR_TSIG at all, so a
+// caller that requires one can tell "absent" apart from Verify's
+// NoError, which also covers an unsigned message it wasn't asked to
+// check.
+func HasTSIG(m *dns.Msg) bool {
+	_, ok := lastTSIG(m)
+	return ok
+}
+
+// lastTSIG returns the final RR_TSIG in m.Extra; m itself is left
+// unchanged. ok is false if m carries no TSIG at all.
+func lastTSIG(m *dns.Msg) (tsig *dns.RR_TSIG, ok bool) {
+	if len(m.Extra) == 0 {
+		return nil, false
+	}
+	rr, isTsig := m.Extra[len(m.Extra)-1].(*dns.RR_TSIG)
+	if !isTsig {
+		return nil, false
+	}
+	return rr, true
+}
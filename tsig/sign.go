@@ -0,0 +1,79 @@
+package tsig
+
+// Outbound signing: a single reply signed with the request's key and
+// MAC, and the "response MAC" continuation RFC 8945 section 5.3.1
+// requires for multi-message AXFR/IXFR, where only roughly every
+// 100th message carries a TSIG covering the running digest.
+
+import (
+	"dns"
+	"os"
+	"time"
+)
+
+// Sign signs m as the direct reply to a request that verified with
+// requestMAC under keyname, appending the RR_TSIG to m.Extra.
+func (v *Verifier) Sign(m *dns.Msg, keyname, requestMAC string) os.Error {
+	algo, secret, ok := v.Provider.Secret(keyname)
+	if !ok {
+		return os.NewError("tsig: unknown key " + keyname)
+	}
+	rr := &dns.RR_TSIG{
+		Hdr:        dns.RR_Header{Name: keyname, Rrtype: dns.TypeTSIG, Class: dns.ClassANY},
+		Algorithm:  algo,
+		TimeSigned: time.Seconds(),
+		Fudge:      uint16(v.Fudge),
+	}
+	if err := rr.SignWithMAC(m, secret, requestMAC); err != nil {
+		return err
+	}
+	m.Extra = append(m.Extra, rr)
+	return nil
+}
+
+// axfrEvery is how many messages pass between TSIGs on an AXFR/IXFR
+// stream, per RFC 8945's "at least every 100 envelopes" guidance.
+const axfrEvery = 100
+
+// AxfrSigner carries the running MAC chain across every message in
+// one AXFR/IXFR response, since each TSIG after the first signs over
+// the previous TSIG's MAC rather than the original request's.
+type AxfrSigner struct {
+	v        *Verifier
+	keyname  string
+	prevMAC  string
+	count    int
+}
+
+// NewAxfrSigner starts a continuation, chained from the MAC of the
+// request that asked for the transfer.
+func (v *Verifier) NewAxfrSigner(keyname, requestMAC string) *AxfrSigner {
+	return &AxfrSigner{v: v, keyname: keyname, prevMAC: requestMAC}
+}
+
+// SignMessage signs m if it is the first message, the last message,
+// or its position in the stream is a multiple of axfrEvery; otherwise it leaves
+// m unsigned, as RFC 8945 allows. last should be true for the final
+// message of the transfer, so the stream always ends on a TSIG.
+func (a *AxfrSigner) SignMessage(m *dns.Msg, last bool) os.Error {
+	a.count++
+	if a.count != 1 && a.count%axfrEvery != 0 && !last {
+		return nil
+	}
+	algo, secret, ok := a.v.Provider.Secret(a.keyname)
+	if !ok {
+		return os.NewError("tsig: unknown key " + a.keyname)
+	}
+	rr := &dns.RR_TSIG{
+		Hdr:        dns.RR_Header{Name: a.keyname, Rrtype: dns.TypeTSIG, Class: dns.ClassANY},
+		Algorithm:  algo,
+		TimeSigned: time.Seconds(),
+		Fudge:      uint16(a.v.Fudge),
+	}
+	if err := rr.SignWithMAC(m, secret, a.prevMAC); err != nil {
+		return err
+	}
+	m.Extra = append(m.Extra, rr)
+	a.prevMAC = rr.MAC
+	return nil
+}
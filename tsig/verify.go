@@ -0,0 +1,173 @@
+package tsig
+
+// Inbound verification: checking a request's trailing RR_TSIG
+// against the key its keyname names, with clock-skew tolerance and
+// a simple replay window.
+
+import (
+	"dns"
+	"strings"
+	"time"
+)
+
+// Status is the outcome of verifying an inbound TSIG, named after
+// the rcodes RFC 8945 maps them to.
+type Status int
+
+const (
+	NoError Status = iota
+	BadKey
+	BadSig
+	BadTime
+	BadTrunc
+)
+
+// String names a Status for logging, e.g. in a qlog.Record.
+func (s Status) String() string {
+	switch s {
+	case NoError:
+		return "NOERROR"
+	case BadKey:
+		return "BADKEY"
+	case BadSig:
+		return "BADSIG"
+	case BadTime:
+		return "BADTIME"
+	case BadTrunc:
+		return "BADTRUNC"
+	}
+	return "UNKNOWN"
+}
+
+// Rcode returns the TSIG error rcode a Status should be rejected
+// with, per RFC 8945 section 5.3.
+func (s Status) Rcode() int {
+	switch s {
+	case BadKey:
+		return dns.RcodeNotAuth // TSIG error 17 (BADKEY) rides on NOTAUTH
+	case BadSig:
+		return dns.RcodeNotAuth // TSIG error 16 (BADSIG)
+	case BadTime:
+		return dns.RcodeNotAuth // TSIG error 18 (BADTIME)
+	case BadTrunc:
+		return dns.RcodeNotAuth // TSIG error 22 (BADTRUNC)
+	}
+	return dns.RcodeSuccess
+}
+
+// DefaultFudge is the default allowed clock skew, in seconds, RFC
+// 8945 section 5.2.3 and common practice both suggest.
+const DefaultFudge = 300
+
+// DefaultReplayWindow bounds how many distinct (keyname, time
+// signed) pairs we remember per key, to catch a resent/replayed
+// request without growing unbounded.
+const DefaultReplayWindow = 256
+
+// Verifier pairs a Provider with the clock-skew tolerance and replay
+// state needed to verify inbound requests and to later sign the
+// matching reply (including multi-message AXFR/IXFR).
+type Verifier struct {
+	Provider Provider
+	Fudge    int64 // seconds
+
+	seen map[string]int64 // "keyname/timesigned" -> last time observed
+}
+
+// NewVerifier returns a Verifier with RFC 8945's suggested fudge
+// factor and an empty replay window.
+func NewVerifier(p Provider) *Verifier {
+	return &Verifier{Provider: p, Fudge: DefaultFudge, seen: map[string]int64{}}
+}
+
+// Verify checks the trailing RR_TSIG in m, if any, and returns the
+// status (NoError if m carries no TSIG at all - the caller decides
+// whether that's acceptable) along with the request MAC, which the
+// reply must be signed with to chain correctly.
+//
+// Note: ideally the Status below would live on a MsgHdr-adjacent
+// field as described in the request that added this pipeline, but
+// dns.MsgHdr is defined outside this tree, so callers thread the
+// Status through explicitly instead.
+func (v *Verifier) Verify(m *dns.Msg) (status Status, requestMAC string) {
+	rr, ok := lastTSIG(m)
+	if !ok {
+		return NoError, ""
+	}
+	algo, secret, known := v.Provider.Secret(rr.Hdr.Name)
+	if !known {
+		return BadKey, ""
+	}
+	if rr.Algorithm != algo {
+		return BadKey, ""
+	}
+
+	// RFC 8945 section 5.2: the MAC must verify before we say
+	// anything about the time window, so an attacker with no key
+	// can't use BADTIME responses as an oracle.
+	if !rr.Verify(m, secret) {
+		return BadSig, rr.MAC
+	}
+
+	now := time.Seconds()
+	skew := now - rr.TimeSigned
+	if skew < 0 {
+		skew = -skew
+	}
+	if skew > v.Fudge {
+		return BadTime, rr.MAC
+	}
+
+	if v.replayed(rr.Hdr.Name, rr.TimeSigned) {
+		return BadSig, rr.MAC
+	}
+	return NoError, rr.MAC
+}
+
+// replayed records (keyname, timesigned) the first time it's seen
+// and reports true on every subsequent sighting, bounding the
+// tracked set to DefaultReplayWindow entries per key.
+func (v *Verifier) replayed(keyname string, timeSigned int64) bool {
+	prefix := keyname + "/"
+	key := prefix + itoa64(timeSigned)
+	if _, ok := v.seen[key]; ok {
+		return true
+	}
+	n := 0
+	for k := range v.seen {
+		if strings.HasPrefix(k, prefix) {
+			n++
+		}
+	}
+	if n >= DefaultReplayWindow {
+		for k := range v.seen {
+			if strings.HasPrefix(k, prefix) {
+				v.seen[k] = 0, false
+			}
+		}
+	}
+	v.seen[key] = time.Seconds()
+	return false
+}
+
+func itoa64(n int64) string {
+	if n == 0 {
+		return "0"
+	}
+	neg := n < 0
+	if neg {
+		n = -n
+	}
+	var buf [20]byte
+	i := len(buf)
+	for n > 0 {
+		i--
+		buf[i] = byte('0' + n%10)
+		n /= 10
+	}
+	if neg {
+		i--
+		buf[i] = '-'
+	}
+	return string(buf[i:])
+}
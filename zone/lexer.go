@@ -0,0 +1,186 @@
+// Package zone is a streaming RFC 1035 zone file lexer and parser:
+// the "Parsing from strings, going with goyacc and own lexer" TODO,
+// done with a hand-written lexer plus a small recursive-descent
+// parser instead of goyacc.
+package zone
+
+import (
+	"bufio"
+	"io"
+	"os"
+)
+
+// zToken is one lexical unit of a zone file. A zone line is built
+// from a sequence of zTokens; zWord covers owner names, TTLs,
+// classes, types and unquoted rdata atoms alike - the parser decides
+// what each one means positionally.
+type zTokenKind int
+
+const (
+	zEOF zTokenKind = iota
+	zNewline
+	zBlank   // line starts with whitespace: reuse the previous owner
+	zWord    // bare atom: name, number, base64/hex blob, etc.
+	zQuoted  // "..." string, exactly as written (no further splitting)
+	zControl // $ORIGIN, $TTL, $INCLUDE, $GENERATE
+)
+
+type zToken struct {
+	kind zTokenKind
+	text string
+}
+
+// lexer turns a zone file into a flat token stream. Parenthesized
+// rdata groups are flattened here: once inside '(' ... ')' newlines
+// are treated as plain whitespace, exactly like RFC 1035 wants.
+type lexer struct {
+	r       *bufio.Reader
+	paren   int
+	atStart bool // true until the first non-blank token of a new line
+}
+
+func newLexer(r io.Reader) *lexer {
+	return &lexer{r: bufio.NewReader(r), atStart: true}
+}
+
+// next returns the next token, or zEOF at end of input.
+func (l *lexer) next() (zToken, os.Error) {
+	for {
+		c, err := l.r.ReadByte()
+		if err == os.EOF {
+			return zToken{zEOF, ""}, nil
+		}
+		if err != nil {
+			return zToken{}, err
+		}
+
+		switch {
+		case c == ';':
+			l.skipComment()
+			continue
+		case c == '\n':
+			if l.paren > 0 {
+				continue // newlines inside (...) are just whitespace
+			}
+			wasStart := l.atStart
+			l.atStart = true
+			if wasStart {
+				continue // blank line
+			}
+			return zToken{zNewline, "\n"}, nil
+		case c == ' ' || c == '\t':
+			if l.atStart {
+				// Leading whitespace on an otherwise-fresh line
+				// means "same owner as before" per RFC 1035.
+				l.atStart = false
+				rest, rerr := l.peekNonBlank()
+				if rerr == nil && rest {
+					return zToken{zBlank, ""}, nil
+				}
+			}
+			continue
+		case c == '(':
+			l.paren++
+			l.atStart = false
+			continue
+		case c == ')':
+			if l.paren > 0 {
+				l.paren--
+			}
+			l.atStart = false
+			continue
+		case c == '"':
+			l.atStart = false
+			s, qerr := l.lexQuoted()
+			return zToken{zQuoted, s}, qerr
+		case c == '$':
+			l.atStart = false
+			word := "$" + l.lexWord()
+			return zToken{zControl, word}, nil
+		default:
+			l.atStart = false
+			l.r.UnreadByte()
+			word := l.lexWord()
+			return zToken{zWord, word}, nil
+		}
+	}
+	panic("unreachable")
+}
+
+// peekNonBlank reports whether the rest of the current physical
+// line (up to '\n', not consuming it) has any non-blank content;
+// used only to decide whether leading whitespace is "blank line" or
+// "owner name omitted, reuse the previous one".
+func (l *lexer) peekNonBlank() (bool, os.Error) {
+	// Whatever we see next, past further blanks, that isn't a
+	// newline/comment means this line does carry fields, just under
+	// an implicit owner. The skipped blanks carry no meaning.
+	for {
+		c, err := l.r.ReadByte()
+		if err != nil {
+			return false, err
+		}
+		if c == ' ' || c == '\t' {
+			continue
+		}
+		l.r.UnreadByte()
+		return c != '\n' && c != ';', nil
+	}
+}
+
+func (l *lexer) skipComment() {
+	for {
+		c, err := l.r.ReadByte()
+		if err != nil || c == '\n' {
+			if err == nil {
+				l.r.UnreadByte()
+			}
+			return
+		}
+	}
+}
+
+func (l *lexer) lexQuoted() (string, os.Error) {
+	buf := make([]byte, 0, 32)
+	for {
+		c, err := l.r.ReadByte()
+		if err != nil {
+			return string(buf), os.NewError("zone: unterminated quoted string")
+		}
+		if c == '\\' {
+			esc, eerr := l.r.ReadByte()
+			if eerr == nil {
+				buf = append(buf, esc)
+			}
+			continue
+		}
+		if c == '"' {
+			return string(buf), nil
+		}
+		buf = append(buf, c)
+	}
+	panic("unreachable")
+}
+
+func (l *lexer) lexWord() string {
+	buf := make([]byte, 0, 32)
+	for {
+		c, err := l.r.ReadByte()
+		if err != nil {
+			break
+		}
+		if c == ' ' || c == '\t' || c == '\n' || c == ';' || c == '(' || c == ')' || c == '"' {
+			l.r.UnreadByte()
+			break
+		}
+		if c == '\\' {
+			esc, eerr := l.r.ReadByte()
+			if eerr == nil {
+				buf = append(buf, esc)
+			}
+			continue
+		}
+		buf = append(buf, c)
+	}
+	return string(buf)
+}
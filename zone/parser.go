@@ -0,0 +1,271 @@
+package zone
+
+// The recursive-descent part: turns the lexer's token stream into
+// dns.RR values, tracking $ORIGIN/$TTL state and the "same owner as
+// the previous line" rule across zBlank tokens.
+
+import (
+	"dns"
+	"io"
+	"os"
+)
+
+// ZoneEntry is one parsed RR, or a parse error for that line; a
+// caller ranging over ParseZone's channel should treat a non-nil Err
+// as fatal for that entry but may keep reading subsequent ones.
+type ZoneEntry struct {
+	RR  dns.RR
+	Err os.Error
+}
+
+// parser holds the running state a zone file carries across lines:
+// current $ORIGIN, current $TTL, last explicit owner/class, plus the
+// token source itself.
+type parser struct {
+	lex *lexer
+
+	origin     string
+	ttl        uint32
+	lastOwner  string
+	lastClass  uint16
+	haveTTL    bool
+	out        chan ZoneEntry
+}
+
+// ParseZone streams rr, reading from r with origin/defaultTTL as the
+// initial $ORIGIN/$TTL. The returned channel is closed once r is
+// exhausted (or an unrecoverable read error occurs), so a 10M-record
+// zone never needs to live in memory at once.
+func ParseZone(r io.Reader, origin string, defaultTTL uint32) <-chan ZoneEntry {
+	p := &parser{
+		lex:    newLexer(r),
+		origin: dns.Fqdn(origin),
+		ttl:    defaultTTL,
+		out:    make(chan ZoneEntry),
+	}
+	go p.run()
+	return p.out
+}
+
+func (p *parser) run() {
+	defer close(p.out)
+	for {
+		fields, err := p.readLine()
+		if err == os.EOF {
+			return
+		}
+		if err != nil {
+			p.out <- ZoneEntry{Err: err}
+			continue
+		}
+		if fields == nil {
+			continue // blank or control-only line, nothing to emit
+		}
+		rr, err := p.parseRR(fields)
+		p.out <- ZoneEntry{RR: rr, Err: err}
+	}
+}
+
+// readLine collects one logical line's tokens (a parenthesized group
+// counts as one line; the lexer already flattened it) and handles
+// $ORIGIN/$TTL/$INCLUDE/$GENERATE directly, returning fields == nil
+// for lines that carry no RR.
+func (p *parser) readLine() ([]zToken, os.Error) {
+	fields := make([]zToken, 0, 8)
+	sawAny := false
+	for {
+		tok, err := p.lex.next()
+		if err != nil {
+			return nil, err
+		}
+		switch tok.kind {
+		case zEOF:
+			if sawAny {
+				return p.resolveOwner(fields), nil
+			}
+			return nil, os.EOF
+		case zNewline:
+			if !sawAny {
+				continue
+			}
+			return p.resolveOwner(fields), nil
+		case zBlank:
+			sawAny = true
+			fields = append(fields, tok)
+		case zControl:
+			if err := p.directive(tok.text); err != nil {
+				return nil, err
+			}
+			// A directive consumes the rest of its own line.
+			for {
+				t, terr := p.lex.next()
+				if terr != nil || t.kind == zEOF {
+					return nil, os.EOF
+				}
+				if t.kind == zNewline {
+					break
+				}
+				fields = append(fields, t)
+			}
+			if len(fields) == 0 {
+				fields = fields[:0]
+				sawAny = false
+				continue
+			}
+			return nil, nil
+		default:
+			sawAny = true
+			fields = append(fields, tok)
+		}
+	}
+	panic("unreachable")
+}
+
+// directive handles $ORIGIN/$TTL by reading exactly the one argument
+// they take; $INCLUDE/$GENERATE are accepted syntactically (so a
+// zone using them doesn't abort the whole parse) but are not
+// expanded - nesting a second reader or generating a range of owner
+// names is out of scope for this package.
+func (p *parser) directive(name string) os.Error {
+	switch name {
+	case "$ORIGIN":
+		tok, err := p.lex.next()
+		if err != nil {
+			return err
+		}
+		p.origin = dns.Fqdn(tok.text)
+	case "$TTL":
+		tok, err := p.lex.next()
+		if err != nil {
+			return err
+		}
+		ttl, ok := parseTTL(tok.text)
+		if !ok {
+			return os.NewError("zone: bad $TTL value " + tok.text)
+		}
+		p.ttl = ttl
+		p.haveTTL = true
+	case "$INCLUDE", "$GENERATE":
+		// Syntax only, see above.
+	default:
+		return os.NewError("zone: unknown control entry " + name)
+	}
+	return nil
+}
+
+// resolveOwner drops a leading zBlank (meaning "reuse lastOwner") and
+// otherwise returns fields unchanged; parseRR records an explicit
+// owner name.
+func (p *parser) resolveOwner(fields []zToken) []zToken {
+	if len(fields) > 0 && fields[0].kind == zBlank {
+		return fields[1:]
+	}
+	return fields
+}
+
+// parseRR interprets one line's fields as [owner] [ttl] [class] type
+// rdata..., applying $ORIGIN to relative/@ owner names, the previous
+// line's class when omitted, and the current $TTL (or ParseZone's
+// defaultTTL) when the TTL is omitted.
+func (p *parser) parseRR(fields []zToken) (dns.RR, os.Error) {
+	if len(fields) == 0 {
+		return nil, os.NewError("zone: empty record")
+	}
+	i := 0
+
+	owner := p.lastOwner
+	if fields[i].kind == zWord && !isTTLOrClassOrType(fields[i].text) {
+		owner = p.ownerName(fields[i].text)
+		i++
+	}
+	if owner == "" {
+		return nil, os.NewError("zone: no owner name and none to inherit")
+	}
+	p.lastOwner = owner
+
+	ttl := p.ttl
+	if i < len(fields) {
+		if t, ok := parseTTL(fields[i].text); ok {
+			ttl = t
+			i++
+		}
+	}
+
+	class := p.lastClass
+	if class == 0 {
+		class = dns.ClassINET
+	}
+	if i < len(fields) {
+		if c, ok := dns.StringToClass[upper(fields[i].text)]; ok {
+			class = c
+			i++
+		}
+	}
+	p.lastClass = class
+
+	if i >= len(fields) {
+		return nil, os.NewError("zone: missing rrtype for " + owner)
+	}
+	rrtype, ok := dns.StringToType[upper(fields[i].text)]
+	if !ok {
+		return nil, os.NewError("zone: unknown rrtype " + fields[i].text)
+	}
+	i++
+
+	hdr := dns.RR_Header{Name: owner, Rrtype: rrtype, Class: class, Ttl: ttl}
+	rdata := fields[i:]
+	return parseRdata(hdr, rdata, p.origin)
+}
+
+// ownerName expands "@" to the current origin and a relative name
+// (one not ending in ".") by appending the origin, leaving absolute
+// names untouched.
+func (p *parser) ownerName(name string) string {
+	if name == "@" {
+		return p.origin
+	}
+	if len(name) > 0 && name[len(name)-1] == '.' {
+		return name
+	}
+	if p.origin == "." {
+		return name + "."
+	}
+	return name + "." + p.origin
+}
+
+func isTTLOrClassOrType(s string) bool {
+	if _, ok := parseTTL(s); ok {
+		return true
+	}
+	if _, ok := dns.StringToClass[upper(s)]; ok {
+		return true
+	}
+	if _, ok := dns.StringToType[upper(s)]; ok {
+		return true
+	}
+	return false
+}
+
+func upper(s string) string {
+	b := []byte(s)
+	for i, c := range b {
+		if c >= 'a' && c <= 'z' {
+			b[i] = c - ('a' - 'A')
+		}
+	}
+	return string(b)
+}
+
+func parseTTL(s string) (uint32, bool) {
+	if s == "" {
+		return 0, false
+	}
+	var n uint32
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return 0, false
+		}
+		n = n*10 + uint32(s[i]-'0')
+	}
+	return n, true
+}
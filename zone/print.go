@@ -0,0 +1,94 @@
+package zone
+
+// PrintRR is ParseZone's inverse for a single RR: enough to write a
+// trust anchor or a small static zone back out in a form ParseZone
+// can read again. It intentionally doesn't try to reproduce original
+// formatting (comments, parenthesized wrapping, $ORIGIN-relative
+// names) - it always emits fully-qualified, one-line records.
+
+import (
+	"dns"
+	"fmt"
+	"strings"
+)
+
+func PrintRR(rr dns.RR) string {
+	h := rr.Header()
+	prefix := fmt.Sprintf("%s\t%d\t%s\t%s\t", h.Name, h.Ttl, dns.ClassToString[h.Class], dns.TypeToString[h.Rrtype])
+
+	switch t := rr.(type) {
+	case *dns.RR_A:
+		return prefix + t.A
+	case *dns.RR_AAAA:
+		return prefix + t.AAAA
+	case *dns.RR_NS:
+		return prefix + t.Ns
+	case *dns.RR_CNAME:
+		return prefix + t.Target
+	case *dns.RR_PTR:
+		return prefix + t.Ptr
+	case *dns.RR_MX:
+		return prefix + fmt.Sprintf("%d %s", t.Preference, t.Mx)
+	case *dns.RR_TXT:
+		return prefix + quote(t.Txt)
+	case *dns.RR_SOA:
+		return prefix + fmt.Sprintf("%s %s %d %d %d %d %d",
+			t.Ns, t.Mbox, t.Serial, t.Refresh, t.Retry, t.Expire, t.Minttl)
+	case *dns.RR_DNSKEY:
+		return prefix + fmt.Sprintf("%d %d %d %s", t.Flags, t.Protocol, t.Algorithm, t.PublicKey)
+	case *dns.RR_RRSIG:
+		return prefix + fmt.Sprintf("%s %d %d %d %d %d %d %s %s",
+			dns.TypeToString[t.TypeCovered], t.Algorithm, t.Labels, t.OrigTtl,
+			t.Expiration, t.Inception, t.KeyTag, t.SignerName, t.Signature)
+	case *dns.RR_DS:
+		return prefix + fmt.Sprintf("%d %d %d %s", t.KeyTag, t.Algorithm, t.DigestType, t.Digest)
+	case *dns.RR_NSEC:
+		return prefix + t.NextDomain + " " + typeList(t.TypeBitMap)
+	case *dns.RR_NSEC3:
+		salt := t.Salt
+		if salt == "" {
+			salt = "-"
+		}
+		return prefix + fmt.Sprintf("%d %d %d %s %s %s", t.Hash, t.Flags, t.Iterations, salt, t.NextDomain, typeList(t.TypeBitMap))
+	case *dns.RR_NSEC3PARAM:
+		salt := t.Salt
+		if salt == "" {
+			salt = "-"
+		}
+		return prefix + fmt.Sprintf("%d %d %d %s", t.Hash, t.Flags, t.Iterations, salt)
+	case *dns.RR_SVCB:
+		return prefix + fmt.Sprintf("%d %s %s", t.Priority, t.Target, svcParams(t.SvcParams))
+	case *dns.RR_HTTPS:
+		return prefix + fmt.Sprintf("%d %s %s", t.Priority, t.Target, svcParams(t.SvcParams))
+	case *dns.RR_RFC3597:
+		return prefix + fmt.Sprintf(`\# %d %s`, t.Rdlength, t.Rdata)
+	}
+	return prefix + fmt.Sprintf("%v", rr)
+}
+
+func quote(s string) string {
+	return `"` + strings.Replace(strings.Replace(s, `\`, `\\`, -1), `"`, `\"`, -1) + `"`
+}
+
+func typeList(types []uint16) string {
+	names := make([]string, len(types))
+	for i, t := range types {
+		names[i] = dns.TypeToString[t]
+	}
+	return strings.Join(names, " ")
+}
+
+// svcParams formats an already-ordered SvcParam slice; it does not
+// re-sort, since parseSVCB hands it the params in ascending
+// SvcParamKey order and that's the order the wire format requires.
+func svcParams(params []SvcParam) string {
+	parts := make([]string, 0, len(params))
+	for _, p := range params {
+		if p.Value == "" {
+			parts = append(parts, p.Key)
+		} else {
+			parts = append(parts, p.Key+"="+p.Value)
+		}
+	}
+	return strings.Join(parts, " ")
+}
@@ -0,0 +1,325 @@
+package zone
+
+// Per-rrtype rdata parsing. Each case unpacks the already-split
+// rdata zTokens (quoted strings preserved, everything else a bare
+// word) into the matching dns.RR_* value.
+
+import (
+	"dns"
+	"encoding/hex"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+func parseRdata(hdr dns.RR_Header, f []zToken, origin string) (dns.RR, os.Error) {
+	switch hdr.Rrtype {
+	case dns.TypeA:
+		return &dns.RR_A{Hdr: hdr, A: word(f, 0)}, need(f, 1, "A")
+	case dns.TypeAAAA:
+		return &dns.RR_AAAA{Hdr: hdr, AAAA: word(f, 0)}, need(f, 1, "AAAA")
+	case dns.TypeNS:
+		return &dns.RR_NS{Hdr: hdr, Ns: fqdn(word(f, 0), origin)}, need(f, 1, "NS")
+	case dns.TypeCNAME:
+		return &dns.RR_CNAME{Hdr: hdr, Target: fqdn(word(f, 0), origin)}, need(f, 1, "CNAME")
+	case dns.TypePTR:
+		return &dns.RR_PTR{Hdr: hdr, Ptr: fqdn(word(f, 0), origin)}, need(f, 1, "PTR")
+	case dns.TypeMX:
+		if err := need(f, 2, "MX"); err != nil {
+			return nil, err
+		}
+		pref, _ := strconv.Atoi(word(f, 0))
+		return &dns.RR_MX{Hdr: hdr, Preference: uint16(pref), Mx: fqdn(word(f, 1), origin)}, nil
+	case dns.TypeTXT:
+		return &dns.RR_TXT{Hdr: hdr, Txt: joinQuoted(f)}, nil
+	case dns.TypeSOA:
+		return parseSOA(hdr, f, origin)
+	case dns.TypeDNSKEY:
+		return parseDNSKEY(hdr, f)
+	case dns.TypeRRSIG:
+		return parseRRSIG(hdr, f, origin)
+	case dns.TypeDS:
+		return parseDS(hdr, f)
+	case dns.TypeNSEC:
+		return parseNSEC(hdr, f, origin)
+	case dns.TypeNSEC3:
+		return parseNSEC3(hdr, f)
+	case dns.TypeNSEC3PARAM:
+		return parseNSEC3PARAM(hdr, f)
+	case dns.TypeSVCB:
+		return parseSVCB(hdr, f, origin, false)
+	case dns.TypeHTTPS:
+		return parseSVCB(hdr, f, origin, true)
+	}
+	return parseUnknown(hdr, f)
+}
+
+func need(f []zToken, n int, what string) os.Error {
+	if len(f) < n {
+		return os.NewError("zone: " + what + " needs " + strconv.Itoa(n) + " rdata fields")
+	}
+	return nil
+}
+
+func word(f []zToken, i int) string {
+	if i >= len(f) {
+		return ""
+	}
+	return f[i].text
+}
+
+func fqdn(name, origin string) string {
+	if name == "@" {
+		return origin
+	}
+	if len(name) > 0 && name[len(name)-1] == '.' {
+		return name
+	}
+	if origin == "." {
+		return name + "."
+	}
+	return name + "." + origin
+}
+
+// joinQuoted concatenates every quoted (or bare) string token into
+// one TXT value; multiple quoted segments on one line are common in
+// hand-written zones for strings over 255 bytes.
+func joinQuoted(f []zToken) string {
+	parts := make([]string, len(f))
+	for i, t := range f {
+		parts[i] = t.text
+	}
+	return strings.Join(parts, "")
+}
+
+func parseSOA(hdr dns.RR_Header, f []zToken, origin string) (dns.RR, os.Error) {
+	if err := need(f, 7, "SOA"); err != nil {
+		return nil, err
+	}
+	serial, _ := strconv.Atoi64(word(f, 2))
+	refresh, _ := strconv.Atoi(word(f, 3))
+	retry, _ := strconv.Atoi(word(f, 4))
+	expire, _ := strconv.Atoi(word(f, 5))
+	minttl, _ := strconv.Atoi(word(f, 6))
+	return &dns.RR_SOA{
+		Hdr:     hdr,
+		Ns:      fqdn(word(f, 0), origin),
+		Mbox:    fqdn(word(f, 1), origin),
+		Serial:  uint32(serial),
+		Refresh: uint32(refresh),
+		Retry:   uint32(retry),
+		Expire:  uint32(expire),
+		Minttl:  uint32(minttl),
+	}, nil
+}
+
+func parseDNSKEY(hdr dns.RR_Header, f []zToken) (dns.RR, os.Error) {
+	if err := need(f, 4, "DNSKEY"); err != nil {
+		return nil, err
+	}
+	flags, _ := strconv.Atoi(word(f, 0))
+	proto, _ := strconv.Atoi(word(f, 1))
+	algo, _ := strconv.Atoi(word(f, 2))
+	key := strings.Join(textsFrom(f, 3), "")
+	return &dns.RR_DNSKEY{
+		Hdr:       hdr,
+		Flags:     uint16(flags),
+		Protocol:  uint8(proto),
+		Algorithm: uint8(algo),
+		PublicKey: key,
+	}, nil
+}
+
+func parseRRSIG(hdr dns.RR_Header, f []zToken, origin string) (dns.RR, os.Error) {
+	if err := need(f, 9, "RRSIG"); err != nil {
+		return nil, err
+	}
+	covered, _ := dns.StringToType[upper(word(f, 0))]
+	algo, _ := strconv.Atoi(word(f, 1))
+	labels, _ := strconv.Atoi(word(f, 2))
+	origttl, _ := strconv.Atoi(word(f, 3))
+	expiration, _ := strconv.Atoi64(word(f, 4))
+	inception, _ := strconv.Atoi64(word(f, 5))
+	keytag, _ := strconv.Atoi(word(f, 6))
+	return &dns.RR_RRSIG{
+		Hdr:         hdr,
+		TypeCovered: covered,
+		Algorithm:   uint8(algo),
+		Labels:      uint8(labels),
+		OrigTtl:     uint32(origttl),
+		Expiration:  expiration,
+		Inception:   inception,
+		KeyTag:      uint16(keytag),
+		SignerName:  fqdn(word(f, 7), origin),
+		Signature:   strings.Join(textsFrom(f, 8), ""),
+	}, nil
+}
+
+func parseDS(hdr dns.RR_Header, f []zToken) (dns.RR, os.Error) {
+	if err := need(f, 4, "DS"); err != nil {
+		return nil, err
+	}
+	keytag, _ := strconv.Atoi(word(f, 0))
+	algo, _ := strconv.Atoi(word(f, 1))
+	digesttype, _ := strconv.Atoi(word(f, 2))
+	digest, err := hex.DecodeString(strings.Join(textsFrom(f, 3), ""))
+	if err != nil {
+		return nil, os.NewError("zone: bad DS digest: " + err.String())
+	}
+	return &dns.RR_DS{
+		Hdr:        hdr,
+		KeyTag:     uint16(keytag),
+		Algorithm:  uint8(algo),
+		DigestType: uint8(digesttype),
+		Digest:     hex.EncodeToString(digest),
+	}, nil
+}
+
+func parseNSEC(hdr dns.RR_Header, f []zToken, origin string) (dns.RR, os.Error) {
+	if err := need(f, 1, "NSEC"); err != nil {
+		return nil, err
+	}
+	types := make([]uint16, 0, len(f)-1)
+	for _, t := range f[1:] {
+		if ty, ok := dns.StringToType[upper(t.text)]; ok {
+			types = append(types, ty)
+		}
+	}
+	return &dns.RR_NSEC{Hdr: hdr, NextDomain: fqdn(word(f, 0), origin), TypeBitMap: types}, nil
+}
+
+func parseNSEC3(hdr dns.RR_Header, f []zToken) (dns.RR, os.Error) {
+	if err := need(f, 5, "NSEC3"); err != nil {
+		return nil, err
+	}
+	halgo, _ := strconv.Atoi(word(f, 0))
+	flags, _ := strconv.Atoi(word(f, 1))
+	iterations, _ := strconv.Atoi(word(f, 2))
+	salt := word(f, 3)
+	if salt == "-" {
+		salt = ""
+	}
+	types := make([]uint16, 0, len(f)-5)
+	for _, t := range f[5:] {
+		if ty, ok := dns.StringToType[upper(t.text)]; ok {
+			types = append(types, ty)
+		}
+	}
+	return &dns.RR_NSEC3{
+		Hdr: hdr, Hash: uint8(halgo), Flags: uint8(flags), Iterations: uint16(iterations),
+		Salt: salt, NextDomain: word(f, 4), TypeBitMap: types,
+	}, nil
+}
+
+func parseNSEC3PARAM(hdr dns.RR_Header, f []zToken) (dns.RR, os.Error) {
+	if err := need(f, 4, "NSEC3PARAM"); err != nil {
+		return nil, err
+	}
+	halgo, _ := strconv.Atoi(word(f, 0))
+	flags, _ := strconv.Atoi(word(f, 1))
+	iterations, _ := strconv.Atoi(word(f, 2))
+	salt := word(f, 3)
+	if salt == "-" {
+		salt = ""
+	}
+	return &dns.RR_NSEC3PARAM{Hdr: hdr, Hash: uint8(halgo), Flags: uint8(flags), Iterations: uint16(iterations), Salt: salt}, nil
+}
+
+// SvcParam is one SvcParamKey=SvcParamValue pair of an SVCB/HTTPS
+// RRset. parseSVCB keeps these in an ordered slice rather than a map:
+// the wire format requires ascending SvcParamKey order, and a map's
+// randomized iteration would make PrintRR's output nondeterministic.
+type SvcParam struct {
+	Key   string
+	Value string
+}
+
+// parseSVCB handles both SVCB and HTTPS, which share a grammar:
+// priority target SvcParam...; SvcParams are key=value (or bare
+// keys for flag-like params), e.g. alpn=h2,h3 or no-default-alpn.
+func parseSVCB(hdr dns.RR_Header, f []zToken, origin string, https bool) (dns.RR, os.Error) {
+	if err := need(f, 2, "SVCB/HTTPS"); err != nil {
+		return nil, err
+	}
+	priority, _ := strconv.Atoi(word(f, 0))
+	target := word(f, 1)
+	if target == "." {
+		target = "."
+	} else {
+		target = fqdn(target, origin)
+	}
+	params := make([]SvcParam, 0, len(f)-2)
+	for _, tok := range f[2:] {
+		kv := strings.Split(tok.text, "=", 2)
+		if len(kv) == 2 {
+			params = append(params, SvcParam{kv[0], kv[1]})
+		} else {
+			params = append(params, SvcParam{kv[0], ""})
+		}
+	}
+	sort.Sort(byKey(params))
+	if https {
+		return &dns.RR_HTTPS{Hdr: hdr, Priority: uint16(priority), Target: target, SvcParams: params}, nil
+	}
+	return &dns.RR_SVCB{Hdr: hdr, Priority: uint16(priority), Target: target, SvcParams: params}, nil
+}
+
+// svcParamKeys maps the registered presentation-format SvcParam key
+// names to their numeric SvcParamKey (RFC 9460 section 14.3.2).
+var svcParamKeys = map[string]int{
+	"mandatory":       0,
+	"alpn":            1,
+	"no-default-alpn": 2,
+	"port":            3,
+	"ipv4hint":        4,
+	"ech":             5,
+	"ipv6hint":        6,
+}
+
+// numericKey returns key's numeric SvcParamKey: a registered name is
+// looked up above, anything else is expected in the generic
+// "keyNNNNN" presentation form.
+func numericKey(key string) int {
+	if n, ok := svcParamKeys[key]; ok {
+		return n
+	}
+	if len(key) > 3 && key[0:3] == "key" {
+		if n, err := strconv.Atoi(key[3:]); err == nil {
+			return n
+		}
+	}
+	return 1<<31 - 1
+}
+
+// byKey sorts SvcParams into ascending numeric SvcParamKey order, as
+// the wire format requires - not alphabetically by name.
+type byKey []SvcParam
+
+func (b byKey) Len() int           { return len(b) }
+func (b byKey) Less(i, j int) bool { return numericKey(b[i].Key) < numericKey(b[j].Key) }
+func (b byKey) Swap(i, j int)      { b[i], b[j] = b[j], b[i] }
+
+// parseUnknown falls back to RFC 3597's generic "\# length hexdata"
+// presentation for any rrtype this package doesn't special-case,
+// rather than failing the whole parse.
+func parseUnknown(hdr dns.RR_Header, f []zToken) (dns.RR, os.Error) {
+	// The lexer has already unescaped `\#` to "#".
+	if len(f) >= 2 && f[0].text == "#" {
+		length, _ := strconv.Atoi(f[1].text)
+		data, err := hex.DecodeString(strings.Join(textsFrom(f, 2), ""))
+		if err != nil {
+			return nil, os.NewError("zone: bad unknown-type rdata: " + err.String())
+		}
+		return &dns.RR_RFC3597{Hdr: hdr, Rdlength: uint16(length), Rdata: hex.EncodeToString(data)}, nil
+	}
+	return nil, os.NewError("zone: no rdata parser for rrtype " + dns.TypeToString[hdr.Rrtype])
+}
+
+func textsFrom(f []zToken, start int) []string {
+	out := make([]string, 0, len(f)-start)
+	for i := start; i < len(f); i++ {
+		out = append(out, f[i].text)
+	}
+	return out
+}